@@ -0,0 +1,46 @@
+package grpcapp
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+func (a *app) initMetrics() {
+	if a.metrics == nil {
+		a.metrics = newMetrics()
+		if a.tools.pool != nil {
+			a.metrics.registry.MustRegister(newDBCollector(a.tools.pool))
+		}
+	}
+}
+
+func (a *app) initAdmin() {
+	if a.adminServer == nil && a.tools.cfg.AdminListenAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(a.metrics.registry, promhttp.HandlerOpts{}))
+		mux.Handle("/methods", MethodsHandler(a))
+		a.adminServer = &http.Server{
+			Addr:    a.tools.cfg.AdminListenAddr,
+			Handler: mux,
+		}
+	}
+}
+
+func (a *app) listenAdmin() (net.Listener, error) {
+	a.tools.log.Info("starting admin server",
+		zap.String("address", a.adminServer.Addr))
+	lis, err := net.Listen("tcp", a.adminServer.Addr)
+	if err != nil {
+		return nil, newError(PhaseListen, "failed to listen admin on "+a.adminServer.Addr, err)
+	}
+	return lis, nil
+}
+
+func (a *app) serveAdmin(lis net.Listener) {
+	if err := a.adminServer.Serve(lis); err != nil && err != http.ErrServerClosed && !isMuxClosed(err) {
+		a.errCh <- newError(PhaseServe, "failed to serve admin", err)
+	}
+}
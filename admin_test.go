@@ -0,0 +1,73 @@
+package grpcapp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func Test_app_admin(t *testing.T) {
+	a := New(WithConfig(&Config{LogLevel: "info", AdminListenAddr: ":0"}))
+	go func() {
+		_ = a.Run(context.Background())
+	}()
+	<-a.Ready()
+	defer func() {
+		_ = a.Stop(context.Background())
+	}()
+
+	conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if _, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) []byte {
+		res, err := http.Get("http://" + a.AdminAddr().String() + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = res.Body.Close()
+		}()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s status = %d", path, res.StatusCode)
+		}
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+
+	metricsBody := string(get("/metrics"))
+	for _, want := range []string{
+		`grpc_server_handled_total{code="OK",method="Check",service="grpc.health.v1.Health"} 1`,
+		"grpc_server_handling_seconds_bucket",
+		"go_goroutines",
+	} {
+		if !strings.Contains(metricsBody, want) {
+			t.Errorf("expected /metrics to contain %q", want)
+		}
+	}
+
+	var methods []MethodInfo
+	if err = json.Unmarshal(get("/methods"), &methods); err != nil {
+		t.Fatal(err)
+	}
+	if len(methods) == 0 {
+		t.Error("expected /methods to list health service methods")
+	}
+}
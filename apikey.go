@@ -0,0 +1,191 @@
+package grpcapp
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"google.golang.org/grpc/metadata"
+)
+
+// APIKey of a client authenticated by APIKeyAuthenticator.
+type APIKey struct {
+
+	// Subject of the key principal.
+	Subject string
+
+	// Key value, compared in constant time.
+	Key string
+
+	// Hash of the key value, hex encoded SHA-256, used if Key is empty.
+	Hash string
+
+	// Scopes granted to the key.
+	Scopes []string
+
+	// Roles of the key principal.
+	Roles []string
+}
+
+// APIKeyStore looks up API keys for APIKeyAuthenticator.
+type APIKeyStore interface {
+
+	// LookupAPIKey returns principal of key or ErrInvalidCredentials if key is
+	// unknown.
+	LookupAPIKey(ctx context.Context, key string) (*Principal, error)
+}
+
+// APIKeyAuthenticator authenticates API keys from "x-api-key" metadata or
+// "authorization" metadata with "ApiKey" scheme, looked up in store. Store
+// implementing UseTools(Tools) receives Tools on application start.
+func APIKeyAuthenticator(store APIKeyStore) Authenticator {
+	return &apiKeyAuthenticator{store}
+}
+
+type apiKeyAuthenticator struct {
+	store APIKeyStore
+}
+
+func (a *apiKeyAuthenticator) UseTools(t Tools) {
+	useTools(a.store, t)
+}
+
+func (a *apiKeyAuthenticator) Authenticate(ctx context.Context, md metadata.MD) (*Principal, error) {
+	key, ok := authorization(md, "ApiKey")
+	if !ok {
+		values := md.Get("x-api-key")
+		if len(values) == 0 || values[0] == "" {
+			return nil, ErrNoCredentials
+		}
+		key = values[0]
+	}
+	return a.store.LookupAPIKey(ctx, key)
+}
+
+// hashAPIKey returns hex encoded SHA-256 of key.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// StaticAPIKeys store of keys.
+func StaticAPIKeys(keys ...APIKey) APIKeyStore {
+	return staticAPIKeys(keys)
+}
+
+type staticAPIKeys []APIKey
+
+func (s staticAPIKeys) LookupAPIKey(_ context.Context, key string) (*Principal, error) {
+	hash := hashAPIKey(key)
+	for _, k := range s {
+		var match bool
+		if k.Key != "" {
+			match = subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1
+		} else {
+			match = subtle.ConstantTimeCompare([]byte(strings.ToLower(k.Hash)), []byte(hash)) == 1
+		}
+		if match {
+			return &Principal{
+				Subject: k.Subject,
+				Scheme:  "apikey",
+				Scopes:  k.Scopes,
+				Roles:   k.Roles,
+			}, nil
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// ParseAPIKeys parses comma separated keys in "<subject>:<key>[:<scopes>]"
+// format, where key may be "sha256=<hex>" hash of the key and scopes are space
+// separated, e.g. "billing:s3cr3t:invoices.read invoices.write,cron:sha256=9f86...".
+func ParseAPIKeys(s string) ([]APIKey, error) {
+	var keys []APIKey
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid api key entry %q", entry)
+		}
+		k := APIKey{Subject: parts[0], Key: parts[1]}
+		if strings.HasPrefix(k.Key, "sha256=") {
+			hash := strings.TrimPrefix(k.Key, "sha256=")
+			if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("invalid sha256 hash of api key %s", k.Subject)
+			}
+			k.Key, k.Hash = "", hash
+		}
+		if len(parts) == 3 {
+			k.Scopes = strings.Fields(parts[2])
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// APIKeysFromEnv store of keys from environment variable name in ParseAPIKeys
+// format.
+func APIKeysFromEnv(name string) (APIKeyStore, error) {
+	keys, err := ParseAPIKeys(os.Getenv(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return StaticAPIKeys(keys...), nil
+}
+
+// PostgresAPIKeys store of keys in table of application database (see
+// WithDatabasePool) with hex encoded SHA-256 hashes of keys:
+//
+//	CREATE TABLE api_keys (
+//		key_hash   text PRIMARY KEY,
+//		subject    text NOT NULL,
+//		scopes     text[] NOT NULL DEFAULT '{}',
+//		roles      text[] NOT NULL DEFAULT '{}',
+//		expires_at timestamptz
+//	);
+//
+// Table name may be qualified with schema, e.g. "auth.api_keys".
+func PostgresAPIKeys(table string) APIKeyStore {
+	return &postgresAPIKeys{table: pgx.Identifier(strings.Split(table, ".")).Sanitize()}
+}
+
+type postgresAPIKeys struct {
+	table string
+	tools Tools
+}
+
+func (s *postgresAPIKeys) UseTools(t Tools) {
+	s.tools = t
+}
+
+func (s *postgresAPIKeys) LookupAPIKey(ctx context.Context, key string) (*Principal, error) {
+	if s.tools == nil || s.tools.DBPool() == nil {
+		return nil, errors.New("api keys database is not initialized")
+	}
+	p := &Principal{Scheme: "apikey"}
+	var expiresAt *time.Time
+	err := s.tools.DBPool().QueryRow(ctx,
+		"SELECT subject, scopes, roles, expires_at FROM "+s.table+" WHERE key_hash = $1",
+		hashAPIKey(key),
+	).Scan(&p.Subject, &p.Scopes, &p.Roles, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up api key: %w", err)
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("api key of %s expired: %w", p.Subject, ErrInvalidCredentials)
+	}
+	return p, nil
+}
@@ -2,32 +2,73 @@ package grpcapp
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/bufbuild/protovalidate-go"
 	"github.com/caarlos0/env/v6"
 	"github.com/golang-jwt/jwt"
 	grpcMiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpcZap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
 	grpcCtxTags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 )
 
 // App interface.
 type App interface {
 
-	// Start the application.
+	// Start the application. Start blocks until the application is stopped, any
+	// error is logged and the process exits.
 	Start()
 
+	// Run the application until ctx is cancelled, Stop is called or shutdown signal
+	// is received. Any failure is returned as *Error.
+	Run(ctx context.Context) error
+
+	// Stop the application gracefully and wait until it is stopped or ctx is done.
+	Stop(ctx context.Context) error
+
+	// Ready returns a channel which is closed once all listeners are accepting
+	// connections, or once Run failed to start the application (listener
+	// addresses are nil then).
+	Ready() <-chan struct{}
+
+	// GrpcAddr returns the address gRPC server is bound to or nil if not listening yet.
+	GrpcAddr() net.Addr
+
+	// HttpAddr returns the address HTTP server is bound to or nil if not listening yet.
+	HttpAddr() net.Addr
+
+	// AdminAddr returns the address admin server is bound to or nil if not listening yet.
+	AdminAddr() net.Addr
+
+	// Methods returns every method registered on gRPC server.
+	Methods() []MethodInfo
+
 	// Tools returns Tools.
 	Tools() Tools
 
@@ -56,9 +97,17 @@ type Tools interface {
 	// Config provided on application init.
 	Config() *Config
 
-	// DB connection if initialized or nil.
+	// DB connection if provided with WithDatabase, otherwise a connection
+	// acquired from DBPool on first use and held until shutdown (re-acquired
+	// if closed), or nil.
+	//
+	// Deprecated: a single pgx.Conn is not safe for concurrent use and is not
+	// health checked by the pool, use DBPool instead.
 	DB() *pgx.Conn
 
+	// DBPool database connection pool if initialized or nil.
+	DBPool() *pgxpool.Pool
+
 	// Logger if provided of application init or nil.
 	Logger() *zap.Logger
 
@@ -67,6 +116,17 @@ type Tools interface {
 
 	// JwtClaims from context or nil.
 	JwtClaims(ctx context.Context) jwt.MapClaims
+
+	// PeerIdentity verified by client TLS certificate from context or nil.
+	PeerIdentity(ctx context.Context) *PeerIdentity
+
+	// Principal authenticated by JWT authentication or Authenticator from
+	// context or nil.
+	Principal(ctx context.Context) *Principal
+
+	// RevokeToken revokes token until its expiration, requires WithTokenRevocation
+	// option.
+	RevokeToken(ctx context.Context, token *jwt.Token) error
 }
 
 // Config of the application.
@@ -75,6 +135,21 @@ type Config struct {
 	// DatabaseDSN from env.
 	DatabaseDSN string `env:"DATABASE_DSN"`
 
+	// DatabaseMaxConns from env (pgxpool default if not set).
+	DatabaseMaxConns int32 `env:"DATABASE_MAX_CONNS"`
+
+	// DatabaseMinConns from env (pgxpool default if not set).
+	DatabaseMinConns int32 `env:"DATABASE_MIN_CONNS"`
+
+	// DatabaseMaxConnIdleTime from env (pgxpool default if not set).
+	DatabaseMaxConnIdleTime time.Duration `env:"DATABASE_MAX_CONN_IDLE_TIME"`
+
+	// DatabaseMaxConnLifetime from env (pgxpool default if not set).
+	DatabaseMaxConnLifetime time.Duration `env:"DATABASE_MAX_CONN_LIFETIME"`
+
+	// DatabaseHealthCheckPeriod from env (pgxpool default if not set).
+	DatabaseHealthCheckPeriod time.Duration `env:"DATABASE_HEALTH_CHECK_PERIOD"`
+
 	// LogLevel from env (default "info").
 	LogLevel string `env:"LOG_LEVEL" envDefault:"info"`
 
@@ -89,10 +164,102 @@ type Config struct {
 
 	// TLSKey file from environment.
 	TLSKey string `env:"TLS_KEY"`
+
+	// TLSClientCA from environment, CA bundle file to verify client certificates
+	// of gRPC listener against (mutual TLS), client certificates are not required
+	// if empty. HTTP listener (WithHTTP option) requires them for native gRPC
+	// requests only, gRPC-Web and REST gateway requests are served without.
+	TLSClientCA string `env:"TLS_CLIENT_CA"`
+
+	// TLSReloadInterval from environment (default 10s), how often TLS files are
+	// checked for changes to be reloaded without restart. Zero disables reload.
+	TLSReloadInterval time.Duration `env:"TLS_RELOAD_INTERVAL" envDefault:"10s"`
+
+	// JwtAlgorithm from environment, enables JWT authentication of tokens signed
+	// with the algorithm (e.g. "HS256", "RS256", "ES256" or "EdDSA") unless
+	// enabled with an option, tokens of other algorithms are rejected.
+	JwtAlgorithm string `env:"JWT_ALGORITHM"`
+
+	// JwtKeyFile from environment, PEM encoded public key (or certificate) file
+	// verifying JwtAlgorithm signatures, or HMAC secret file.
+	JwtKeyFile string `env:"JWT_KEY_FILE"`
+
+	// JwtSecret from environment, HMAC secret, takes precedence over JwtKeyFile.
+	JwtSecret string `env:"JWT_SECRET"`
+
+	// JwtIssuer from environment, expected in "iss" claim, not validated if empty.
+	JwtIssuer string `env:"JWT_ISSUER"`
+
+	// JwtAudience from environment, expected in "aud" claim, not validated if empty.
+	JwtAudience string `env:"JWT_AUDIENCE"`
+
+	// JwtMethods from environment, comma separated methods requiring JWT
+	// authentication (all methods if empty), may be path.Match patterns, e.g.
+	// "/pkg.Greeter/*".
+	JwtMethods []string `env:"JWT_METHODS" envSeparator:","`
+
+	// AuthorizationPolicyFile from environment, YAML or JSON file with authorization
+	// Policy, see WithAuthorizationPolicy option.
+	AuthorizationPolicyFile string `env:"AUTHORIZATION_POLICY_FILE"`
+
+	// HttpAllowH2C from environment, allows HTTP server to serve cleartext
+	// HTTP/2 (h2c) and HTTP/1.1 when TLSCertificate and TLSKey are not set,
+	// e.g. behind a TLS-terminating proxy.
+	HttpAllowH2C bool `env:"HTTP_ALLOW_H2C"`
+
+	// SinglePort from environment, serves gRPC, HTTP (WithHTTP option) and admin
+	// (non-empty AdminListenAddr) traffic on a single GrpcListenPort listener.
+	SinglePort bool `env:"SINGLE_PORT"`
+
+	// ShutdownDrainDelay from environment, delay before servers are stopped
+	// on shutdown while health service reports NOT_SERVING, to let load
+	// balancers drain the traffic.
+	ShutdownDrainDelay time.Duration `env:"SHUTDOWN_DRAIN_DELAY"`
+
+	// ShutdownTimeout from environment (default 30s), after which gRPC and HTTP
+	// servers are stopped forcibly. Zero means wait for graceful stop forever.
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s"`
+
+	// GrpcWebAllowedOrigins from environment, comma separated list of origins allowed
+	// to make gRPC-Web requests, "*" allows any origin.
+	GrpcWebAllowedOrigins []string `env:"GRPC_WEB_ALLOWED_ORIGINS" envSeparator:","`
+
+	// GrpcWebAllowedHeaders from environment, comma separated list of headers allowed
+	// in gRPC-Web requests (all headers are allowed if empty).
+	GrpcWebAllowedHeaders []string `env:"GRPC_WEB_ALLOWED_HEADERS" envSeparator:","`
+
+	// AdminListenAddr from environment, address of plaintext admin HTTP server
+	// exposing /metrics and /methods (e.g. ":9090"). Admin server is disabled if empty.
+	AdminListenAddr string `env:"ADMIN_LISTEN_ADDR"`
+
+	// TracingExporter from environment, "otlp" (default) or "stdout". Used with
+	// WithTracing option only.
+	TracingExporter string `env:"TRACING_EXPORTER"`
+
+	// TracingServiceName from environment, service name reported in traces.
+	TracingServiceName string `env:"TRACING_SERVICE_NAME"`
+
+	// GrpcReflection from environment enables gRPC server reflection, same as
+	// WithReflection option.
+	GrpcReflection bool `env:"GRPC_REFLECTION"`
+
+	// HealthCheckInterval from environment (default 10s), how often health
+	// checkers are polled.
+	HealthCheckInterval time.Duration `env:"HEALTH_CHECK_INTERVAL" envDefault:"10s"`
 }
 
+// StartHook is called before application starts listening. If any StartHook
+// returns an error, the application will not start.
 type StartHook func(App) error
 
+// StopHook is called on graceful shutdown after gRPC server is stopped, or when the
+// application fails to start after start hooks succeeded. The context provided is
+// cancelled when the hook timeout is exceeded.
+type StopHook func(context.Context, App) error
+
+// DefaultStopHookTimeout is used when StopHook is registered without timeout.
+const DefaultStopHookTimeout = 10 * time.Second
+
 // Start shortcut to New().Start().
 func Start(options ...Option) {
 	New(options...).Start()
@@ -101,8 +268,12 @@ func Start(options ...Option) {
 // New app generator.
 func New(options ...Option) App {
 	a := &app{
-		tools: &tools{},
-		done:  make(chan struct{}),
+		tools:      &tools{},
+		done:       make(chan struct{}),
+		ready:      make(chan struct{}),
+		stop:       make(chan struct{}),
+		shutdownCh: make(chan os.Signal, 1),
+		errCh:      make(chan error, 4),
 	}
 	for _, o := range options {
 		o.option(a)
@@ -116,31 +287,144 @@ const (
 )
 
 type app struct {
-	serviceImplementations []serviceImplementation
-	serverOptions          []grpc.ServerOption
-	unaryInterceptors      []grpc.UnaryServerInterceptor
-	streamInterceptors     []grpc.StreamServerInterceptor
-	tools                  *tools
-	serveHttp              bool
-	grpcServer             *grpc.Server
-	httpServer             *http.Server
-	startHooks             []StartHook
-	done                   chan struct{}
-	shutdownCh             chan os.Signal
+	serviceImplementations  []serviceImplementation
+	serverOptions           []grpc.ServerOption
+	unaryInterceptors       []grpc.UnaryServerInterceptor
+	streamInterceptors      []grpc.StreamServerInterceptor
+	tools                   *tools
+	closePool               bool
+	serveHttp               bool
+	grpcServer              *grpc.Server
+	httpServer              *http.Server
+	inflight                *inflight
+	jwtEnabled              bool
+	reflection              bool
+	health                  *health.Server
+	healthCheckers          []healthChecker
+	healthCancel            context.CancelFunc
+	startHooks              []StartHook
+	stopHooks               []stopHook
+	done                    chan struct{}
+	ready                   chan struct{}
+	stop                    chan struct{}
+	stopOnce                sync.Once
+	shutdownCh              chan os.Signal
+	errCh                   chan error
+	addrMu                  sync.RWMutex
+	grpcAddr                net.Addr
+	httpAddr                net.Addr
+	adminAddr               net.Addr
+	adminServer             *http.Server
+	metrics                 *metrics
+	tracing                 bool
+	tracerProvider          *sdktrace.TracerProvider
+	propagator              propagation.TextMapPropagator
+	gatewayRegister         []GatewayRegisterFunc
+	gatewayMuxOptions       []runtime.ServeMuxOption
+	gatewayMux              *runtime.ServeMux
+	gatewayConn             *grpc.ClientConn
+	gatewayLis              *gatewayListener
+	grpcWebEnabled          bool
+	grpcWeb                 *grpcweb.WrappedGrpcServer
+	httpRequests            sync.WaitGroup
+	h2cClosing              chan struct{}
+	h2cCloseOnce            *sync.Once
+	tls                     *certReloader
+	peerAuth                []peerAuthRule
+	policy                  *Policy
+	compiledPolicy          *compiledPolicy
+	protoAuth               bool
+	protoAuthFailClosed     bool
+	authn                   *authn
+	revocationPurgeInterval time.Duration
+	revocationCancel        context.CancelFunc
+	revocationDone          chan struct{}
+	panicHandler            PanicHandler
+	validation              bool
+	validator               *protovalidate.Validator
 }
 
 func (a *app) Start() {
+	if err := a.Run(context.Background()); err != nil {
+		if a.tools.log != nil {
+			a.tools.log.Error("application failed",
+				zap.Error(err))
+		} else {
+			_, _ = fmt.Fprintln(os.Stderr, "application failed:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func (a *app) Run(ctx context.Context) error {
+	// release resources and unblock Ready and Stop if the application
+	// fails to start
+	started, hooksStarted := false, false
+	defer func() {
+		if !started {
+			if hooksStarted {
+				a.runStopHooks()
+			}
+			a.closeGateway()
+			a.closeDatabase()
+			a.shutdownTracing(context.Background())
+			close(a.ready)
+			close(a.done)
+		}
+	}()
+
 	// read environment configuration
-	a.initConfig()
+	if err := a.initConfig(); err != nil {
+		return err
+	}
 
 	// initialize zap logger
-	a.initLogger()
+	if err := a.initLogger(); err != nil {
+		return err
+	}
 
-	// note: any error prior this line will panic,
-	//       logger.Fatal will be called downwards
+	// initialize tracing
+	if err := a.initTracing(); err != nil {
+		return err
+	}
 
 	// initialize database
-	a.initDatabase()
+	if err := a.initDatabase(); err != nil {
+		return err
+	}
+
+	// load tls certificates
+	if err := a.initTLS(); err != nil {
+		return err
+	}
+
+	// validate peer authorization rules
+	if err := a.initPeerAuth(); err != nil {
+		return err
+	}
+
+	// load jwt keys from config
+	if err := a.initJwtConfig(); err != nil {
+		return err
+	}
+
+	// validate authentication configuration
+	if err := a.initAuthn(); err != nil {
+		return err
+	}
+
+	// load authorization policy
+	if err := a.initPolicy(); err != nil {
+		return err
+	}
+
+	// create request validator
+	if err := a.initValidation(); err != nil {
+		return err
+	}
+
+	// initialize metrics
+	a.initMetrics()
 
 	// initialize servers
 	a.initServers()
@@ -148,14 +432,76 @@ func (a *app) Start() {
 	// initialize service implementations
 	a.initServiceImplementations()
 
+	// initialize http handler
+	if err := a.initHttpHandler(); err != nil {
+		return err
+	}
+
+	// register health service
+	a.initHealth()
+
+	// initialize admin server
+	a.initAdmin()
+
+	// run start hooks
+	if err := a.runStartHooks(); err != nil {
+		return err
+	}
+	hooksStarted = true
+
 	// start servers
-	a.listen()
+	if err := a.listen(); err != nil {
+		return err
+	}
 
-	// listen to "shutdown" signals
-	a.shutdown()
+	// purge expired revoked tokens
+	a.startRevocationPurge()
+
+	// report services as serving
+	a.startHealthChecks()
+	started = true
+
+	// handle termination signals from the moment the app is reported ready,
+	// stopped on return of wait
+	signal.Notify(a.shutdownCh, syscall.SIGINT, syscall.SIGTERM)
+	close(a.ready)
+
+	// wait for context, "shutdown" signals or serve errors
+	return a.wait(ctx)
+}
 
-	// wait
-	<-a.done
+func (a *app) Stop(ctx context.Context) error {
+	a.stopOnce.Do(func() {
+		close(a.stop)
+	})
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *app) Ready() <-chan struct{} {
+	return a.ready
+}
+
+func (a *app) GrpcAddr() net.Addr {
+	a.addrMu.RLock()
+	defer a.addrMu.RUnlock()
+	return a.grpcAddr
+}
+
+func (a *app) HttpAddr() net.Addr {
+	a.addrMu.RLock()
+	defer a.addrMu.RUnlock()
+	return a.httpAddr
+}
+
+func (a *app) AdminAddr() net.Addr {
+	a.addrMu.RLock()
+	defer a.addrMu.RUnlock()
+	return a.adminAddr
 }
 
 func (a *app) Tools() Tools {
@@ -170,20 +516,22 @@ func (a *app) HttpServer() *http.Server {
 	return a.httpServer
 }
 
-func (a *app) initConfig() {
+func (a *app) initConfig() error {
 	if a.tools.cfg == nil {
-		a.tools.cfg = new(Config)
-		if err := env.Parse(a.tools.cfg); err != nil {
-			panic("failed to parse config:" + err.Error())
+		cfg := new(Config)
+		if err := env.Parse(cfg); err != nil {
+			return newError(PhaseConfig, "failed to parse config", err)
 		}
+		a.tools.cfg = cfg
 	}
+	return nil
 }
 
-func (a *app) initLogger() {
+func (a *app) initLogger() error {
 	if a.tools.log == nil {
 		lvl, err := zapcore.ParseLevel(a.tools.cfg.LogLevel)
 		if err != nil {
-			panic("invalid log level: " + a.tools.cfg.LogLevel)
+			return newError(PhaseLogger, "invalid log level "+a.tools.cfg.LogLevel, err)
 		}
 		cfg := zap.NewProductionConfig()
 		cfg.Level = zap.NewAtomicLevelAt(lvl)
@@ -194,9 +542,10 @@ func (a *app) initLogger() {
 
 		a.tools.log, err = cfg.Build()
 		if err != nil {
-			panic("failed to build logger config: " + err.Error())
+			return newError(PhaseLogger, "failed to build logger config", err)
 		}
 	}
+	return nil
 }
 
 func (a *app) initServiceImplementations() {
@@ -209,16 +558,88 @@ func (a *app) initServiceImplementations() {
 				zap.String("serviceName", desc.ServiceName))
 		}
 	}
+	a.initProtoAuth()
 }
 
-func (a *app) initDatabase() {
-	if a.tools.db == nil && a.tools.cfg.DatabaseDSN != "" {
-		var err error
-		a.tools.db, err = pgx.Connect(context.Background(), a.tools.cfg.DatabaseDSN)
+func (a *app) runStartHooks() error {
+	for i, hook := range a.startHooks {
+		if err := hook(a); err != nil {
+			return newError(PhaseStartHook, fmt.Sprintf("start hook %d failed", i), err)
+		}
+	}
+	return nil
+}
+
+func (a *app) runStopHooks() {
+	for i := len(a.stopHooks) - 1; i >= 0; i-- {
+		h := a.stopHooks[i]
+		ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- h.hook(ctx, a)
+		}()
+		select {
+		case err := <-errCh:
+			if err != nil {
+				a.tools.log.Error("stop hook failed",
+					zap.Int("hook", i),
+					zap.Error(err))
+			} else {
+				a.tools.log.Info("stop hook done",
+					zap.Int("hook", i))
+			}
+		case <-ctx.Done():
+			a.tools.log.Error("stop hook timed out",
+				zap.Int("hook", i),
+				zap.Duration("timeout", h.timeout))
+		}
+		cancel()
+	}
+}
+
+func (a *app) initDatabase() error {
+	if a.tools.db == nil && a.tools.pool == nil && a.tools.cfg.DatabaseDSN != "" {
+		cfg, err := pgxpool.ParseConfig(a.tools.cfg.DatabaseDSN)
 		if err != nil {
-			a.tools.log.Fatal("failed to connect to database",
-				zap.Error(err))
+			return newError(PhaseDatabase, "failed to parse database dsn", err)
 		}
+		if a.tools.cfg.DatabaseMaxConns > 0 {
+			cfg.MaxConns = a.tools.cfg.DatabaseMaxConns
+		}
+		if a.tools.cfg.DatabaseMinConns > 0 {
+			cfg.MinConns = a.tools.cfg.DatabaseMinConns
+		}
+		if a.tools.cfg.DatabaseMaxConnIdleTime > 0 {
+			cfg.MaxConnIdleTime = a.tools.cfg.DatabaseMaxConnIdleTime
+		}
+		if a.tools.cfg.DatabaseMaxConnLifetime > 0 {
+			cfg.MaxConnLifetime = a.tools.cfg.DatabaseMaxConnLifetime
+		}
+		if a.tools.cfg.DatabaseHealthCheckPeriod > 0 {
+			cfg.HealthCheckPeriod = a.tools.cfg.DatabaseHealthCheckPeriod
+		}
+		if a.tracerProvider != nil {
+			// queries are logged with info level
+			cfg.ConnConfig.Logger = newDBTracer(a.tracerProvider, cfg.ConnConfig.Logger, cfg.ConnConfig.LogLevel)
+			if cfg.ConnConfig.LogLevel < pgx.LogLevelInfo {
+				cfg.ConnConfig.LogLevel = pgx.LogLevelInfo
+			}
+		}
+		a.tools.pool, err = pgxpool.ConnectConfig(context.Background(), cfg)
+		if err != nil {
+			return newError(PhaseDatabase, "failed to connect to database", err)
+		}
+		a.closePool = true
+	}
+	return nil
+}
+
+func (a *app) closeDatabase() {
+	a.tools.releaseDB()
+	if a.closePool {
+		a.tools.pool.Close()
+		a.closePool = false
+		a.tools.log.Info("closed database pool")
 	}
 }
 
@@ -265,108 +686,403 @@ func (a *app) initServers() {
 				return zapcore.ErrorLevel
 			}),
 		}
-		unaryInterceptors := append([]grpc.UnaryServerInterceptor{
-			grpcCtxTags.UnaryServerInterceptor(grpcCtxTags.WithFieldExtractor(grpcCtxTags.CodeGenRequestFieldExtractor)),
+		a.inflight = newInflight()
+		unaryInterceptors := []grpc.UnaryServerInterceptor{a.inflight.unaryInterceptor}
+		streamInterceptors := []grpc.StreamServerInterceptor{a.inflight.streamInterceptor}
+		if a.metrics != nil {
+			unaryInterceptors = append(unaryInterceptors, a.metrics.unaryInterceptor)
+			streamInterceptors = append(streamInterceptors, a.metrics.streamInterceptor)
+		}
+		if a.tracerProvider != nil {
+			ui, si := a.makeTracingInterceptors()
+			unaryInterceptors = append(unaryInterceptors, ui)
+			streamInterceptors = append(streamInterceptors, si)
+		}
+		unaryInterceptors = append(unaryInterceptors,
+			grpcCtxTags.UnaryServerInterceptor(grpcCtxTags.WithFieldExtractor(grpcCtxTags.CodeGenRequestFieldExtractor)))
+		streamInterceptors = append(streamInterceptors,
+			grpcCtxTags.StreamServerInterceptor(grpcCtxTags.WithFieldExtractor(grpcCtxTags.CodeGenRequestFieldExtractor)))
+		if a.tracerProvider != nil {
+			unaryInterceptors = append(unaryInterceptors, traceTagsUnaryInterceptor)
+			streamInterceptors = append(streamInterceptors, traceTagsStreamInterceptor)
+		}
+		recoveryUnary, recoveryStream := a.makeRecoveryInterceptors()
+		unaryInterceptors = append(append(unaryInterceptors,
 			grpcZap.UnaryServerInterceptor(a.tools.log, opts...),
-		}, a.unaryInterceptors...)
-		streamInterceptors := append([]grpc.StreamServerInterceptor{
-			grpcCtxTags.StreamServerInterceptor(grpcCtxTags.WithFieldExtractor(grpcCtxTags.CodeGenRequestFieldExtractor)),
+			recoveryUnary,
+		), a.unaryInterceptors...)
+		streamInterceptors = append(append(streamInterceptors,
 			grpcZap.StreamServerInterceptor(a.tools.log, opts...),
-		}, a.streamInterceptors...)
-		if a.tools.jwt != nil && a.tools.jwt.keyFunc != nil {
+			recoveryStream,
+		), a.streamInterceptors...)
+		if a.tools.revocation != nil {
+			useTools(a.tools.revocation, a.tools)
+		}
+		if a.compiledPolicy == nil && a.protoAuth {
+			// filled with proto auth options on services registration
+			a.compiledPolicy, _ = compilePolicy(&Policy{})
+		}
+		if a.tools.jwt != nil && (a.tools.jwt.keyFunc != nil || a.tools.jwt.introspection != nil) {
+			a.tools.jwt.policy = a.compiledPolicy
 			ui, si := makeJwtInterceptors(a.tools)
 			unaryInterceptors = append(unaryInterceptors, ui)
 			streamInterceptors = append(streamInterceptors, si)
+			a.jwtEnabled = true
+		}
+		if a.authn != nil {
+			a.authn.policy = a.compiledPolicy
+			ui, si := a.authn.interceptors(a.tools)
+			unaryInterceptors = append(unaryInterceptors, ui)
+			streamInterceptors = append(streamInterceptors, si)
+		}
+		if a.compiledPolicy != nil {
+			ui, si := makePolicyInterceptors(a.compiledPolicy, a.tools.log)
+			unaryInterceptors = append(unaryInterceptors, ui)
+			streamInterceptors = append(streamInterceptors, si)
+		}
+		if len(a.peerAuth) > 0 {
+			ui, si := makePeerAuthInterceptors(a.peerAuth, a.tools.log)
+			unaryInterceptors = append(unaryInterceptors, ui)
+			streamInterceptors = append(streamInterceptors, si)
+		}
+		if a.validation {
+			ui, si := a.makeValidationInterceptors()
+			unaryInterceptors = append(unaryInterceptors, ui)
+			streamInterceptors = append(streamInterceptors, si)
+		}
+		if a.tls != nil {
+			// prepended to let provided server options override credentials
+			a.serverOptions = append([]grpc.ServerOption{
+				grpc.Creds(serverCredentials{credentials.NewTLS(a.tls.config(tls.RequireAndVerifyClientCert, "h2"))}),
+			}, a.serverOptions...)
 		}
 		a.serverOptions = append(a.serverOptions,
 			grpcMiddleware.WithUnaryServerChain(unaryInterceptors...),
 			grpcMiddleware.WithStreamServerChain(streamInterceptors...),
 		)
 		a.grpcServer = grpc.NewServer(a.serverOptions...)
+		if a.reflection || a.tools.cfg.GrpcReflection {
+			reflection.Register(a.grpcServer)
+			a.tools.log.Info("registered grpc reflection")
+		}
 	}
 	if a.httpServer == nil {
 		a.httpServer = &http.Server{
-			Addr:    fmt.Sprintf(":%d", a.tools.cfg.HttpListenPort),
-			Handler: a.grpcServer,
+			Addr: fmt.Sprintf(":%d", a.tools.cfg.HttpListenPort),
 		}
-	} else {
-		a.httpServer.Handler = a.grpcServer
+	}
+	if a.tls != nil && a.httpServer.TLSConfig == nil {
+		// browsers (gRPC-Web, REST gateway) may not present client certificates,
+		// native grpc requests without them are rejected by the handler
+		a.httpServer.TLSConfig = a.tls.config(tls.VerifyClientCertIfGiven, "h2", "http/1.1")
 	}
 }
 
-func (a *app) listen() {
-	go a.listenGrpc()
+func (a *app) initHttpHandler() error {
 	if a.serveHttp {
-		go a.listenHttp()
+		if err := a.initGateway(); err != nil {
+			return err
+		}
+		a.initGrpcWeb()
+	}
+	handler := a.trackHttpRequests(a.requireClientCertificate(a.httpHandler()))
+	if a.serveHttp && a.httpH2C() {
+		var err error
+		if handler, err = a.h2cHandler(handler); err != nil {
+			return err
+		}
+	}
+	a.httpServer.Handler = handler
+	return nil
+}
+
+// trackHttpRequests counts requests being handled by the HTTP server, so
+// shutdown can wait for them before stopping the grpc server: grpc streams
+// served over ServeHTTP do not support graceful draining.
+func (a *app) trackHttpRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.httpRequests.Add(1)
+		defer a.httpRequests.Done()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// httpHandler routes gRPC-Web and native gRPC requests to gRPC server and everything
+// else to grpc-gateway, if enabled.
+func (a *app) httpHandler() http.Handler {
+	if a.gatewayMux == nil && a.grpcWeb == nil {
+		return a.grpcServer
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case a.grpcWeb != nil && (a.grpcWeb.IsGrpcWebRequest(r) || a.grpcWeb.IsAcceptableGrpcCorsRequest(r)):
+			a.grpcWeb.ServeHTTP(w, r)
+		case a.gatewayMux == nil || isGrpcRequest(r):
+			a.grpcServer.ServeHTTP(w, r)
+		default:
+			a.gatewayMux.ServeHTTP(w, r)
+		}
+	})
+}
+
+// isGrpcRequest reports whether r is a native gRPC request, gRPC-Web
+// content-types are not matched.
+func isGrpcRequest(r *http.Request) bool {
+	if r.ProtoMajor != 2 {
+		return false
 	}
+	ct := r.Header.Get("Content-Type")
+	return ct == "application/grpc" ||
+		strings.HasPrefix(ct, "application/grpc+") ||
+		strings.HasPrefix(ct, "application/grpc;")
 }
 
-func (a *app) listenGrpc() {
+func (a *app) listen() error {
+	if a.tools.cfg.SinglePort {
+		return a.listenSingle()
+	}
+	grpcLis, err := a.listenGrpc()
+	if err != nil {
+		return err
+	}
+	var httpLis net.Listener
+	if a.serveHttp {
+		if httpLis, err = a.listenHttp(); err != nil {
+			_ = grpcLis.Close()
+			return err
+		}
+	}
+	var adminLis net.Listener
+	if a.adminServer != nil {
+		if adminLis, err = a.listenAdmin(); err != nil {
+			_ = grpcLis.Close()
+			if httpLis != nil {
+				_ = httpLis.Close()
+			}
+			return err
+		}
+	}
+	a.serve(grpcLis, httpLis, adminLis)
+	return nil
+}
+
+func (a *app) serve(grpcLis, httpLis, adminLis net.Listener) {
+	a.addrMu.Lock()
+	if grpcLis != nil {
+		a.grpcAddr = grpcLis.Addr()
+	}
+	if httpLis != nil {
+		a.httpAddr = httpLis.Addr()
+	}
+	if adminLis != nil {
+		a.adminAddr = adminLis.Addr()
+	}
+	a.addrMu.Unlock()
+	if grpcLis != nil {
+		go a.serveGrpc(grpcLis)
+	}
+	if httpLis != nil {
+		if a.httpH2C() {
+			go a.serveHttpH2C(httpLis)
+		} else {
+			go a.serveHttpTLS(httpLis)
+		}
+	}
+	if adminLis != nil {
+		go a.serveAdmin(adminLis)
+	}
+	if a.gatewayLis != nil {
+		go a.serveGateway()
+	}
+}
+
+func (a *app) listenGrpc() (net.Listener, error) {
 	addr := fmt.Sprintf(":%d", a.tools.cfg.GrpcListenPort)
 	a.tools.log.Info("starting grpc server",
 		zap.String("address", addr))
 	lis, err := net.Listen("tcp", addr)
 	if err != nil {
-		a.tools.log.Fatal("failed to listen grpc",
+		return nil, newError(PhaseListen, "failed to listen grpc on "+addr, err)
+	}
+	return lis, nil
+}
+
+func (a *app) listenHttp() (net.Listener, error) {
+	addr := a.httpServer.Addr
+	if a.httpH2C() {
+		a.tools.log.Warn("starting http server without tls (h2c)",
+			zap.String("address", addr))
+		if addr == "" {
+			addr = ":http"
+		}
+	} else {
+		a.tools.log.Info("starting http server",
 			zap.String("address", addr),
-			zap.Error(err))
+			zap.String("tlsCertificate", a.tools.cfg.TLSCertificate),
+			zap.String("tlsKey", a.tools.cfg.TLSKey))
+		if err := a.checkHttpTLS(); err != nil {
+			return nil, err
+		}
+		if addr == "" {
+			addr = ":https"
+		}
 	}
-	if err = a.grpcServer.Serve(lis); err != nil {
-		a.tools.log.Fatal("failed to serve grpc",
-			zap.Error(err))
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, newError(PhaseListen, "failed to listen http on "+addr, err)
 	}
+	return lis, nil
 }
 
-func (a *app) listenHttp() {
-	a.tools.log.Info("starting http server",
-		zap.String("address", a.httpServer.Addr),
-		zap.String("tlsCertificate", a.tools.cfg.TLSCertificate),
-		zap.String("tlsKey", a.tools.cfg.TLSKey))
+func (a *app) checkHttpTLS() error {
 	if a.tools.cfg.TLSCertificate == "" {
-		a.tools.log.Fatal("cannot start http server without tls certificate")
+		return newError(PhaseListen, "cannot start http server", errors.New("tls certificate is missing (set HTTP_ALLOW_H2C to serve h2c)"))
 	}
 	if a.tools.cfg.TLSKey == "" {
-		a.tools.log.Fatal("cannot start http server without tls key")
+		return newError(PhaseListen, "cannot start http server", errors.New("tls key is missing"))
 	}
-	if err := a.httpServer.ListenAndServeTLS(
-		a.tools.cfg.TLSCertificate,
-		a.tools.cfg.TLSKey,
-	); err != nil && err != http.ErrServerClosed {
-		a.tools.log.Fatal("failed to serve http",
-			zap.Error(err))
+	if _, err := tls.LoadX509KeyPair(a.tools.cfg.TLSCertificate, a.tools.cfg.TLSKey); err != nil {
+		return newError(PhaseListen, "failed to load tls key pair", err)
 	}
+	return nil
 }
 
-func (a *app) shutdown() {
-	go func() {
-		a.shutdownCh = make(chan os.Signal)
-		signal.Notify(a.shutdownCh, os.Interrupt, os.Kill)
-		sig := <-a.shutdownCh
+func (a *app) serveGrpc(lis net.Listener) {
+	if err := a.grpcServer.Serve(lis); err != nil && !isMuxClosed(err) {
+		a.errCh <- newError(PhaseServe, "failed to serve grpc", err)
+	}
+}
+
+func (a *app) serveHttpTLS(lis net.Listener) {
+	certFile, keyFile := a.tools.cfg.TLSCertificate, a.tools.cfg.TLSKey
+	if cfg := a.httpServer.TLSConfig; cfg != nil && cfg.GetCertificate != nil {
+		// reloaded certificates
+		certFile, keyFile = "", ""
+	}
+	if err := a.httpServer.ServeTLS(lis, certFile, keyFile); err != nil && err != http.ErrServerClosed && !isMuxClosed(err) {
+		a.errCh <- newError(PhaseServe, "failed to serve http", err)
+	}
+}
+
+func (a *app) wait(ctx context.Context) error {
+	defer signal.Stop(a.shutdownCh)
+
+	var err error
+	select {
+	case <-ctx.Done():
+		a.tools.log.Info("graceful shutdown",
+			zap.String("reason", ctx.Err().Error()))
+	case <-a.stop:
+		a.tools.log.Info("graceful shutdown",
+			zap.String("reason", "stop called"))
+	case sig := <-a.shutdownCh:
 		a.tools.log.Info("graceful shutdown",
 			zap.String("signal", sig.String()))
+	case err = <-a.errCh:
+		a.tools.log.Error("graceful shutdown",
+			zap.Error(err))
+	}
+	a.shutdown()
+	return err
+}
+
+func (a *app) shutdown() {
+	// report services as not serving
+	a.stopHealth()
+
+	// wait for load balancers to drain the traffic
+	if delay := a.tools.cfg.ShutdownDrainDelay; delay > 0 {
+		a.tools.log.Info("draining before shutdown",
+			zap.Duration("delay", delay))
+		<-time.After(delay)
+	}
+
+	ctx := context.Background()
+	if timeout := a.tools.cfg.ShutdownTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// stop http server (optionally) first, forcibly if timeout exceeded, and
+	// wait for its handlers to return before stopping the grpc server
+	if a.serveHttp {
+		if err := a.httpServer.Shutdown(ctx); err != nil {
+			a.tools.log.Error("failed to shutdown http server gracefully",
+				zap.Error(err))
+			_ = a.httpServer.Close()
+		}
+		a.waitHttpRequests(ctx)
+		a.tools.log.Info("stopped http server")
+	}
 
-		// stop grpc server
+	// stop grpc server, forcibly if timeout exceeded
+	stopped := make(chan struct{})
+	go func() {
 		a.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
 		a.tools.log.Info("stopped grpc server")
+	case <-ctx.Done():
+		fields := []zap.Field{zap.Duration("timeout", a.tools.cfg.ShutdownTimeout)}
+		if a.inflight != nil {
+			calls, total := a.inflight.snapshot()
+			fields = append(fields,
+				zap.Int("inFlight", total),
+				zap.Any("calls", calls))
+		}
+		a.tools.log.Warn("shutdown timeout exceeded, forcing grpc server stop", fields...)
+		a.grpcServer.Stop()
+		<-stopped
+		a.tools.log.Info("stopped grpc server forcibly")
+	}
 
-		// stop http server (optionally)
-		if a.serveHttp {
-			if err := a.httpServer.Shutdown(context.Background()); err != nil {
-				a.tools.log.Error("failed to shutdown http server gracefully",
-					zap.Error(err))
-			}
-			a.tools.log.Info("stopped http server")
+	// close in-process gateway connection
+	a.closeGateway()
+
+	// stop admin server (optionally)
+	if a.adminServer != nil {
+		if err := a.adminServer.Shutdown(ctx); err != nil {
+			a.tools.log.Error("failed to shutdown admin server gracefully",
+				zap.Error(err))
+			_ = a.adminServer.Close()
 		}
-		a.done <- struct{}{}
-		close(a.done)
-	}()
+		a.tools.log.Info("stopped admin server")
+	}
+
+	// run stop hooks in reverse order
+	a.runStopHooks()
+
+	// stop purging revoked tokens
+	a.stopRevocationPurge()
+
+	// flush and stop tracing
+	a.shutdownTracing(ctx)
+
+	// close database pool (only if created by app)
+	a.closeDatabase()
+
+	close(a.done)
 }
 
 type tools struct {
-	cfg *Config
-	log *zap.Logger
-	db  *pgx.Conn
-	jwt *jwtData
+	cfg  *Config
+	log  *zap.Logger
+	db   *pgx.Conn
+	pool *pgxpool.Pool
+	jwt  *jwtData
+
+	// dbMu guards db acquired from pool as dbConn
+	dbMu   sync.Mutex
+	dbConn *pgxpool.Conn
+
+	// jwtClaims registered with WithJwtClaims or nil for jwt.MapClaims
+	jwtClaims func() jwt.Claims
+
+	// revocation store checked by JWT authentication or nil
+	revocation RevocationStore
 }
 
 // Config provided on application init.
@@ -374,11 +1090,43 @@ func (t *tools) Config() *Config {
 	return t.cfg
 }
 
-// DB connection if initialized or nil.
+// DB connection if provided with WithDatabase, otherwise a connection acquired
+// from DBPool on first use and held until shutdown (re-acquired if closed), or nil.
 func (t *tools) DB() *pgx.Conn {
+	t.dbMu.Lock()
+	defer t.dbMu.Unlock()
+	if t.dbConn != nil && t.db.IsClosed() {
+		// broken connections are destroyed by the pool on release
+		t.dbConn.Release()
+		t.dbConn, t.db = nil, nil
+	}
+	if t.db == nil && t.pool != nil {
+		conn, err := t.pool.Acquire(context.Background())
+		if err != nil {
+			t.log.Error("failed to acquire database connection",
+				zap.Error(err))
+			return nil
+		}
+		t.dbConn, t.db = conn, conn.Conn()
+	}
 	return t.db
 }
 
+// releaseDB connection acquired from pool by DB.
+func (t *tools) releaseDB() {
+	t.dbMu.Lock()
+	defer t.dbMu.Unlock()
+	if t.dbConn != nil {
+		t.dbConn.Release()
+		t.dbConn, t.db = nil, nil
+	}
+}
+
+// DBPool database connection pool if initialized or nil.
+func (t *tools) DBPool() *pgxpool.Pool {
+	return t.pool
+}
+
 // Logger if provided of application init or nil.
 func (t *tools) Logger() *zap.Logger {
 	return t.log
@@ -398,13 +1146,24 @@ func (t *tools) JwtToken(ctx context.Context) *jwt.Token {
 // JwtClaims from context or nil.
 func (t *tools) JwtClaims(ctx context.Context) jwt.MapClaims {
 	if token := t.JwtToken(ctx); token != nil {
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		if claims, err := mapClaims(token); err == nil {
 			return claims
 		}
 	}
 	return nil
 }
 
+// PeerIdentity verified by client TLS certificate from context or nil.
+func (t *tools) PeerIdentity(ctx context.Context) *PeerIdentity {
+	return peerIdentity(ctx)
+}
+
+// Principal authenticated by JWT authentication or Authenticator from
+// context or nil.
+func (t *tools) Principal(ctx context.Context) *Principal {
+	return principalFrom(ctx)
+}
+
 // WithConfig replaces the default Config. Environment variables will not be parsed.
 func WithConfig(cfg *Config) Option {
 	return &configOption{cfg}
@@ -467,6 +1226,8 @@ func (opt *grpcServerOptionsOption) option(a *app) {
 
 // WithDatabase replaces the default database connection. If used - the app will not
 // try to connect using DatabaseDSN provided in Config.
+//
+// Deprecated: a single pgx.Conn is not safe for concurrent use, use WithDatabasePool instead.
 func WithDatabase(db *pgx.Conn) Option {
 	return &databaseOption{db}
 }
@@ -479,8 +1240,24 @@ func (opt *databaseOption) option(a *app) {
 	a.tools.db = opt.db
 }
 
+// WithDatabasePool replaces the default database connection pool. If used - the app
+// will not try to connect using DatabaseDSN provided in Config.
+func WithDatabasePool(pool *pgxpool.Pool) Option {
+	return &databasePoolOption{pool}
+}
+
+type databasePoolOption struct {
+	pool *pgxpool.Pool
+}
+
+func (opt *databasePoolOption) option(a *app) {
+	a.tools.pool = opt.pool
+}
+
 // WithHTTP option enables http server to listen in addition to gRPC server.
-// When enabled TLSCertificate and TLSKey in Config must be provided.
+// When enabled TLSCertificate and TLSKey in Config must be provided, unless
+// HttpAllowH2C (HTTP_ALLOW_H2C) allows serving cleartext HTTP/2 (h2c) and
+// HTTP/1.1 behind a TLS-terminating proxy.
 func WithHTTP() Option {
 	return new(httpOption)
 }
@@ -521,7 +1298,11 @@ func (opt *httpServerOption) option(a *app) {
 }
 
 // WithJwtAuthentication enables JWT authentication for provided methods. If not methods
-// provided, the authentication will be enabled for all requests.
+// provided, the authentication will be enabled for all requests except of the health
+// service (grpc.health.v1.Health), which is never authenticated. Methods may be
+// path.Match patterns, e.g. "/pkg.Greeter/*". Tokens are read from "authorization"
+// metadata with or without "Bearer" prefix. JWT authentication may be configured
+// with JwtAlgorithm and its key from environment instead.
 func WithJwtAuthentication(keyFunc jwt.Keyfunc, methods ...string) Option {
 	return &jwtAuthOption{keyFunc, methods}
 }
@@ -532,29 +1313,136 @@ type jwtAuthOption struct {
 }
 
 func (opt *jwtAuthOption) option(a *app) {
-	a.tools.jwt = &jwtData{opt.keyFunc, opt.methods}
+	a.tools.jwt = &jwtData{keyFunc: opt.keyFunc, methods: opt.methods}
 }
 
 type jwtData struct {
 	keyFunc jwt.Keyfunc
 	methods []string
+
+	// parser and validate replace the default claims validation if set
+	parser   *jwt.Parser
+	validate func(*jwt.Token) error
+	jwks     *jwks
+
+	// introspection replaces parsing of tokens if set
+	introspection *introspection
+
+	// policy rules (proto auth options included) take precedence over methods,
+	// methods of public rules are not authenticated, of other rules are always
+	// authenticated
+	policy *compiledPolicy
+}
+
+// checkConfig fails on misconfigured key set or introspection endpoint.
+func (j *jwtData) checkConfig() error {
+	if j.jwks != nil {
+		if err := j.jwks.checkConfig(); err != nil {
+			return err
+		}
+	}
+	if j.introspection != nil {
+		if err := j.introspection.checkConfig(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skip reports whether method does not require authentication.
+func (j *jwtData) skip(method string) bool {
+	if healthMethod(method) {
+		return true
+	}
+	if required, ok := j.policy.requiresAuth(method); ok {
+		return !required
+	}
+	return len(j.methods) > 0 && !matchMethod(j.methods, method)
+}
+
+// principal of verified token.
+func (j *jwtData) principal(token *jwt.Token) *Principal {
+	p := jwtPrincipal(token)
+	if j.introspection != nil {
+		p.Scheme = "introspection"
+	}
+	return p
+}
+
+// parse and validate raw token into registered claims type if newClaims is not nil.
+func (j *jwtData) parse(ctx context.Context, raw string, newClaims func() jwt.Claims) (*jwt.Token, error) {
+	if j.introspection != nil {
+		token, err := j.introspection.token(ctx, raw, newClaims)
+		if err == nil {
+			if v, ok := token.Claims.(ClaimsValidator); ok {
+				err = v.Validate()
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return token, nil
+	}
+	parser := j.parser
+	if parser == nil {
+		parser = new(jwt.Parser)
+	}
+	var token *jwt.Token
+	var err error
+	if newClaims != nil {
+		token, err = parser.ParseWithClaims(raw, newClaims(), j.keyFunc)
+	} else {
+		token, err = parser.Parse(raw, j.keyFunc)
+	}
+	if err == nil && j.validate != nil {
+		err = j.validate(token)
+	}
+	if err == nil {
+		if v, ok := token.Claims.(ClaimsValidator); ok {
+			err = v.Validate()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// matchMethod reports whether method matches any of patterns, "*" matches any
+// method, other patterns use path.Match syntax, e.g. "/pkg.Greeter/*". Method
+// patterns of all options and policy rules are matched by it.
+func matchMethod(patterns []string, method string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, method); ok || pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPatterns returns error of the first malformed path.Match pattern,
+// which would match nothing.
+func checkPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
 }
 
 func makeJwtInterceptors(t *tools) (
 	grpc.UnaryServerInterceptor,
 	grpc.StreamServerInterceptor,
 ) {
-	const (
-		authHeader  = "authorization"
-		tokenHeader = TokenContextKey
-	)
+	const tokenHeader = TokenContextKey
 
 	errUnauthorized := status.Error(codes.Unauthenticated, "unauthenticated")
-	checkMethods := len(t.jwt.methods) > 0
-	useMethods := make(map[string]struct{}, len(t.jwt.methods))
-
-	for _, method := range t.jwt.methods {
-		useMethods[method] = struct{}{}
+	if t.jwt.jwks != nil {
+		t.jwt.jwks.log = t.log
+	}
+	if t.jwt.introspection != nil {
+		t.jwt.introspection.log = t.log
 	}
 
 	getToken := func(ctx context.Context) (*jwt.Token, error) {
@@ -563,13 +1451,16 @@ func makeJwtInterceptors(t *tools) (
 			t.log.Debug("failed to extract metadata from context")
 			return nil, errUnauthorized
 		}
-		values := md[authHeader]
-		if len(values) == 0 {
+		raw, ok := bearerToken(md)
+		if !ok {
 			t.log.Debug("authorization token not found in metadata",
 				zap.Any("md", md))
 			return nil, errUnauthorized
 		}
-		token, err := jwt.Parse(values[0], t.jwt.keyFunc)
+		token, err := t.jwt.parse(ctx, raw, t.jwtClaims)
+		if err == nil {
+			err = t.checkRevoked(ctx, token)
+		}
 		if err != nil {
 			t.log.Warn("failed to validate token",
 				zap.Error(err),
@@ -585,16 +1476,15 @@ func makeJwtInterceptors(t *tools) (
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (any, error) {
-		if checkMethods {
-			if _, ok := useMethods[info.FullMethod]; !ok {
-				return handler(ctx, req)
-			}
+		if t.jwt.skip(info.FullMethod) {
+			return handler(ctx, req)
 		}
 		token, err := getToken(ctx)
 		if err != nil {
 			return nil, err
 		}
-		return handler(context.WithValue(ctx, tokenHeader, token), req)
+		ctx = context.WithValue(ctx, tokenHeader, token)
+		return handler(withPrincipal(ctx, t.jwt.principal(token)), req)
 	}
 
 	streamInterceptor := func(
@@ -603,17 +1493,16 @@ func makeJwtInterceptors(t *tools) (
 		info *grpc.StreamServerInfo,
 		handler grpc.StreamHandler,
 	) error {
-		if checkMethods {
-			if _, ok := useMethods[info.FullMethod]; !ok {
-				return handler(srv, stream)
-			}
+		if t.jwt.skip(info.FullMethod) {
+			return handler(srv, stream)
 		}
 		token, err := getToken(stream.Context())
 		if err != nil {
 			return err
 		}
+		ctx := context.WithValue(stream.Context(), tokenHeader, token)
 		return handler(srv, &grpcStreamWrapper{
-			ctx:    context.WithValue(stream.Context(), tokenHeader, token),
+			ctx:    withPrincipal(ctx, t.jwt.principal(token)),
 			stream: stream,
 		})
 	}
@@ -694,3 +1583,33 @@ func (opt *startHookOption) option(a *app) {
 		a.startHooks = append(a.startHooks, opt.hook)
 	}
 }
+
+// WithStopHook appends StopHook to run on graceful shutdown. Stop hooks are executed
+// in reverse order, each limited by its own timeout (DefaultStopHookTimeout if
+// timeout is not positive).
+func WithStopHook(hook StopHook, timeout time.Duration) Option {
+	return &stopHookOption{hook, timeout}
+}
+
+type stopHookOption struct {
+	hook    StopHook
+	timeout time.Duration
+}
+
+type stopHook struct {
+	hook    StopHook
+	timeout time.Duration
+}
+
+func (opt *stopHookOption) option(a *app) {
+	if opt.hook != nil {
+		timeout := opt.timeout
+		if timeout <= 0 {
+			timeout = DefaultStopHookTimeout
+		}
+		a.stopHooks = append(a.stopHooks, stopHook{
+			hook:    opt.hook,
+			timeout: timeout,
+		})
+	}
+}
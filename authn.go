@@ -0,0 +1,373 @@
+package grpcapp
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrNoCredentials returned by Authenticator if request has no credentials
+	// of its scheme, chained authenticators try the next one.
+	ErrNoCredentials = errors.New("no credentials")
+
+	// ErrInvalidCredentials returned by built-in authenticators if request
+	// credentials are unknown or do not match.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal authenticated by JWT authentication or Authenticator, available to
+// handlers with Tools.Principal and authorized by Policy.
+type Principal struct {
+
+	// Subject of the principal, "sub" claim, API key subject or Basic user name.
+	Subject string
+
+	// Scheme of the authentication, e.g. "jwt", "introspection", "apikey" or
+	// "basic".
+	Scheme string
+
+	// Scopes granted to the principal.
+	Scopes []string
+
+	// Roles of the principal, roles of JWT principal are read by Policy from
+	// its RolesClaim instead.
+	Roles []string
+
+	// Claims of JWT token or nil.
+	Claims jwt.MapClaims
+
+	// Token of JWT principal or nil.
+	Token *jwt.Token
+}
+
+// Authenticator authenticates requests by incoming metadata. Authenticator
+// implementing UseTools(Tools) receives Tools on application start, like
+// service implementations.
+type Authenticator interface {
+
+	// Authenticate returns Principal of request, ErrNoCredentials if metadata
+	// has no credentials of authenticator scheme or other error if credentials
+	// are invalid.
+	Authenticate(ctx context.Context, md metadata.MD) (*Principal, error)
+}
+
+// AuthenticatorFunc adapts function to Authenticator.
+type AuthenticatorFunc func(ctx context.Context, md metadata.MD) (*Principal, error)
+
+// Authenticate calls f(ctx, md).
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, md metadata.MD) (*Principal, error) {
+	return f(ctx, md)
+}
+
+// ChainAuthenticators returns Authenticator accepting credentials of any of
+// authenticators, tried in order until one of them finds its credentials.
+func ChainAuthenticators(authenticators ...Authenticator) Authenticator {
+	return authenticatorChain(authenticators)
+}
+
+type authenticatorChain []Authenticator
+
+func (c authenticatorChain) Authenticate(ctx context.Context, md metadata.MD) (*Principal, error) {
+	for _, auth := range c {
+		p, err := auth.Authenticate(ctx, md)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+func (c authenticatorChain) UseTools(t Tools) {
+	for _, auth := range c {
+		useTools(auth, t)
+	}
+}
+
+func (c authenticatorChain) checkConfig() error {
+	for _, auth := range c {
+		if err := checkConfig(auth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkConfig fails on misconfigured built-in authenticator v.
+func checkConfig(v any) error {
+	if c, ok := v.(interface{ checkConfig() error }); ok {
+		return c.checkConfig()
+	}
+	return nil
+}
+
+// useTools passes Tools to v if it implements UseTools.
+func useTools(v any, t Tools) {
+	if u, ok := v.(interface{ UseTools(Tools) }); ok {
+		u.UseTools(t)
+	}
+}
+
+// WithAuthenticator authenticates calls of methods (all methods but the health
+// service if empty) with auth. Methods matched by several options accept
+// credentials of any of their authenticators, in order of options. Method names
+// may be path.Match patterns, e.g. "/pkg.Greeter/*". Calls without valid
+// credentials fail with Unauthenticated.
+//
+//	grpcapp.New(
+//		grpcapp.WithAuthenticator(grpcapp.JwtAuthenticator(keyFunc)),
+//		grpcapp.WithAuthenticator(grpcapp.APIKeyAuthenticator(keys), "/pkg.Internal/*"),
+//	)
+//
+// Use JwtAuthenticator instead of WithJwtAuthentication option to accept JWT
+// along with other schemes.
+func WithAuthenticator(auth Authenticator, methods ...string) Option {
+	return &authenticatorOption{auth, methods}
+}
+
+type authenticatorOption struct {
+	auth    Authenticator
+	methods []string
+}
+
+func (opt *authenticatorOption) option(a *app) {
+	if a.authn == nil {
+		a.authn = new(authn)
+	}
+	a.authn.rules = append(a.authn.rules, authnRule{opt.auth, opt.methods})
+}
+
+type authnRule struct {
+	auth    Authenticator
+	methods []string
+}
+
+func (r authnRule) applies(method string) bool {
+	return len(r.methods) == 0 || matchMethod(r.methods, method)
+}
+
+type authn struct {
+	rules []authnRule
+
+	// policy rules (proto auth options included) take precedence over rule
+	// methods, methods of public rules are not authenticated, of other rules
+	// are authenticated with all authenticators
+	policy *compiledPolicy
+}
+
+// initAuthn fails on misconfigured key sets and introspection endpoints of JWT
+// authentication and authenticators, which would fail every authenticated call.
+func (a *app) initAuthn() error {
+	if a.tools.jwt != nil {
+		if err := a.tools.jwt.checkConfig(); err != nil {
+			return newError(PhaseConfig, "invalid jwt authentication", err)
+		}
+	}
+	if a.authn != nil {
+		for _, rule := range a.authn.rules {
+			if err := checkConfig(rule.auth); err != nil {
+				return newError(PhaseConfig, "invalid authenticator", err)
+			}
+		}
+	}
+	return nil
+}
+
+// authenticator of method or nil if method is not authenticated.
+func (n *authn) authenticator(method string) Authenticator {
+	if healthMethod(method) {
+		return nil
+	}
+	all := false
+	if required, ok := n.policy.requiresAuth(method); ok {
+		if !required {
+			return nil
+		}
+		all = true
+	}
+	var chain authenticatorChain
+	for _, r := range n.rules {
+		if all || r.applies(method) {
+			chain = append(chain, r.auth)
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	return chain
+}
+
+func (n *authn) interceptors(t *tools) (
+	grpc.UnaryServerInterceptor,
+	grpc.StreamServerInterceptor,
+) {
+	for _, r := range n.rules {
+		useTools(r.auth, t)
+	}
+	errUnauthenticated := status.Error(codes.Unauthenticated, "unauthenticated")
+
+	authenticate := func(ctx context.Context, method string) (context.Context, error) {
+		auth := n.authenticator(method)
+		if auth == nil {
+			return ctx, nil
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		p, err := auth.Authenticate(ctx, md)
+		if err == nil && p == nil {
+			err = ErrNoCredentials
+		}
+		if err == nil && p.Token != nil {
+			err = t.checkRevoked(ctx, p.Token)
+		}
+		if errors.Is(err, ErrNoCredentials) {
+			t.log.Debug("credentials not found in metadata",
+				zap.String("method", method))
+			return nil, errUnauthenticated
+		}
+		if err != nil {
+			t.log.Warn("failed to authenticate",
+				zap.String("method", method),
+				zap.Error(err))
+			return nil, errUnauthenticated
+		}
+		if p.Token != nil {
+			ctx = context.WithValue(ctx, TokenContextKey, p.Token)
+		}
+		return withPrincipal(ctx, p), nil
+	}
+
+	unaryInterceptor := func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		ctx, err := authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+
+	streamInterceptor := func(
+		srv any,
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := authenticate(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &grpcStreamWrapper{ctx: ctx, stream: stream})
+	}
+
+	return unaryInterceptor, streamInterceptor
+}
+
+type principalContextKey struct{}
+
+func withPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// principalFrom context, made of JWT token if context has no principal.
+func principalFrom(ctx context.Context) *Principal {
+	if p, ok := ctx.Value(principalContextKey{}).(*Principal); ok {
+		return p
+	}
+	if token, ok := ctx.Value(TokenContextKey).(*jwt.Token); ok && token != nil {
+		return jwtPrincipal(token)
+	}
+	return nil
+}
+
+// jwtPrincipal of verified token.
+func jwtPrincipal(token *jwt.Token) *Principal {
+	p := &Principal{Scheme: "jwt", Token: token}
+	if claims, err := mapClaims(token); err == nil {
+		p.Claims = claims
+		p.Subject, _ = claims["sub"].(string)
+		p.Scopes = scopes(claims)
+		p.Roles = stringList(claims["roles"])
+	}
+	return p
+}
+
+// authorization header value of scheme (case-insensitive) or false.
+func authorization(md metadata.MD, scheme string) (string, bool) {
+	for _, v := range md.Get("authorization") {
+		if len(v) > len(scheme) && v[len(scheme)] == ' ' && strings.EqualFold(v[:len(scheme)], scheme) {
+			return strings.TrimSpace(v[len(scheme)+1:]), true
+		}
+	}
+	return "", false
+}
+
+// bearerToken returns token of "authorization" metadata with "Bearer" scheme,
+// or bare token without scheme.
+func bearerToken(md metadata.MD) (string, bool) {
+	if token, ok := authorization(md, "Bearer"); ok {
+		return token, true
+	}
+	for _, v := range md.Get("authorization") {
+		if v != "" && !strings.Contains(v, " ") {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// JwtAuthenticator authenticates bearer JWT tokens ("authorization" metadata
+// with or without "Bearer" prefix) verified with keyFunc. Tokens are parsed into
+// claims type registered with WithJwtClaims and available with Tools.JwtToken.
+func JwtAuthenticator(keyFunc jwt.Keyfunc) Authenticator {
+	return &jwtAuthenticator{jwt: &jwtData{keyFunc: keyFunc}}
+}
+
+// JwksAuthenticator is JwtAuthenticator verifying tokens with keys of JSON
+// Web Key Set like WithJwksAuthentication option.
+func JwksAuthenticator(cfg JwksConfig) Authenticator {
+	return &jwtAuthenticator{jwt: newJwksData(cfg)}
+}
+
+type jwtAuthenticator struct {
+	jwt       *jwtData
+	jwtClaims func() jwt.Claims
+}
+
+func (j *jwtAuthenticator) UseTools(t Tools) {
+	if t, ok := t.(*tools); ok {
+		j.jwtClaims = t.jwtClaims
+		if j.jwt.jwks != nil {
+			j.jwt.jwks.log = t.log
+		}
+		if j.jwt.introspection != nil {
+			j.jwt.introspection.log = t.log
+		}
+	}
+}
+
+func (j *jwtAuthenticator) checkConfig() error {
+	return j.jwt.checkConfig()
+}
+
+func (j *jwtAuthenticator) Authenticate(ctx context.Context, md metadata.MD) (*Principal, error) {
+	raw, ok := bearerToken(md)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	token, err := j.jwt.parse(ctx, raw, j.jwtClaims)
+	if err != nil {
+		return nil, err
+	}
+	return j.jwt.principal(token), nil
+}
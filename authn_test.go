@@ -0,0 +1,365 @@
+package grpcapp
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestChainAuthenticators(t *testing.T) {
+	errBroken := errors.New("broken")
+	none := AuthenticatorFunc(func(context.Context, metadata.MD) (*Principal, error) {
+		return nil, ErrNoCredentials
+	})
+	broken := AuthenticatorFunc(func(context.Context, metadata.MD) (*Principal, error) {
+		return nil, errBroken
+	})
+	alice := AuthenticatorFunc(func(context.Context, metadata.MD) (*Principal, error) {
+		return &Principal{Subject: "alice"}, nil
+	})
+	tests := []struct {
+		name    string
+		chain   Authenticator
+		want    string
+		wantErr error
+	}{
+		{"empty", ChainAuthenticators(), "", ErrNoCredentials},
+		{"no credentials", ChainAuthenticators(none, none), "", ErrNoCredentials},
+		{"next", ChainAuthenticators(none, alice), "alice", nil},
+		{"first", ChainAuthenticators(alice, broken), "alice", nil},
+		{"invalid stops chain", ChainAuthenticators(none, broken, alice), "", errBroken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.chain.Authenticate(context.Background(), metadata.MD{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && p.Subject != tt.want {
+				t.Errorf("Authenticate() subject = %v, want %v", p.Subject, tt.want)
+			}
+		})
+	}
+}
+
+func TestJwtAuthenticator(t *testing.T) {
+	secret := []byte("secret")
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "alice",
+		"scope": "read write",
+		"roles": []any{"admin"},
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := JwtAuthenticator(func(*jwt.Token) (any, error) {
+		return secret, nil
+	})
+	tests := []struct {
+		name    string
+		md      metadata.MD
+		wantErr error
+	}{
+		{"bare", metadata.Pairs("authorization", signed), nil},
+		{"bearer", metadata.Pairs("authorization", "Bearer "+signed), nil},
+		{"lower case bearer", metadata.Pairs("authorization", "bearer "+signed), nil},
+		{"missing", metadata.MD{}, ErrNoCredentials},
+		{"other scheme", metadata.Pairs("authorization", "Basic YWxpY2U6cGFzcw=="), ErrNoCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := auth.Authenticate(context.Background(), tt.md)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if p.Scheme != "jwt" || p.Subject != "alice" || p.Token == nil {
+				t.Errorf("unexpected principal %+v", p)
+			}
+			if !reflect.DeepEqual(p.Scopes, []string{"read", "write"}) || !reflect.DeepEqual(p.Roles, []string{"admin"}) {
+				t.Errorf("unexpected scopes %v or roles %v", p.Scopes, p.Roles)
+			}
+		})
+	}
+	if _, err = auth.Authenticate(context.Background(), metadata.Pairs("authorization", "Bearer invalid")); err == nil || errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Authenticate() of invalid token error = %v", err)
+	}
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	auth := APIKeyAuthenticator(StaticAPIKeys(
+		APIKey{Subject: "plain", Key: "plain-key", Scopes: []string{"read"}},
+		APIKey{Subject: "hashed", Hash: hashAPIKey("hashed-key"), Roles: []string{"admin"}},
+	))
+	tests := []struct {
+		name    string
+		md      metadata.MD
+		want    string
+		wantErr error
+	}{
+		{"header", metadata.Pairs("x-api-key", "plain-key"), "plain", nil},
+		{"authorization", metadata.Pairs("authorization", "ApiKey hashed-key"), "hashed", nil},
+		{"unknown", metadata.Pairs("x-api-key", "unknown"), "", ErrInvalidCredentials},
+		{"missing", metadata.Pairs("authorization", "Bearer token"), "", ErrNoCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := auth.Authenticate(context.Background(), tt.md)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (p.Subject != tt.want || p.Scheme != "apikey") {
+				t.Errorf("unexpected principal %+v", p)
+			}
+		})
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	hash := hashAPIKey("key")
+	tests := []struct {
+		name    string
+		s       string
+		want    []APIKey
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"keys", "a:key-a, b:key-b:read write", []APIKey{
+			{Subject: "a", Key: "key-a"},
+			{Subject: "b", Key: "key-b", Scopes: []string{"read", "write"}},
+		}, false},
+		{"hashed", "a:sha256=" + hash, []APIKey{{Subject: "a", Hash: hash}}, false},
+		{"invalid hash", "a:sha256=abc", nil, true},
+		{"no key", "a", nil, true},
+		{"no subject", ":key", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAPIKeys(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAPIKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAPIKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeysFromEnv(t *testing.T) {
+	t.Setenv("TEST_API_KEYS", "a:key-a")
+	store, err := APIKeysFromEnv("TEST_API_KEYS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := store.LookupAPIKey(context.Background(), "key-a"); err != nil || p.Subject != "a" {
+		t.Errorf("LookupAPIKey() = %v, %v", p, err)
+	}
+	t.Setenv("TEST_API_KEYS", "invalid")
+	if _, err = APIKeysFromEnv("TEST_API_KEYS"); err == nil {
+		t.Error("APIKeysFromEnv() expected error")
+	}
+}
+
+func TestPostgresAPIKeys(t *testing.T) {
+	store := PostgresAPIKeys("auth.api_keys").(*postgresAPIKeys)
+	if store.table != `"auth"."api_keys"` {
+		t.Errorf("table = %v", store.table)
+	}
+	if _, err := store.LookupAPIKey(context.Background(), "key"); err == nil {
+		t.Error("LookupAPIKey() without database expected error")
+	}
+}
+
+func Test_postgresAPIKeys_LookupAPIKey(t *testing.T) {
+	pool, schema := testDatabaseSchema(t)
+	ctx := context.Background()
+	_, err := pool.Exec(ctx, `CREATE TABLE `+schema+`.api_keys (
+		key_hash   text PRIMARY KEY,
+		subject    text NOT NULL,
+		scopes     text[] NOT NULL DEFAULT '{}',
+		roles      text[] NOT NULL DEFAULT '{}',
+		expires_at timestamptz
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = pool.Exec(ctx, `INSERT INTO `+schema+`.api_keys (key_hash, subject, scopes, roles, expires_at) VALUES
+		($1, 'cron', '{internal}', '{admin}', NULL),
+		($2, 'old', '{}', '{}', now() - interval '1 hour'),
+		($3, 'temp', '{read}', '{user}', now() + interval '1 hour')`,
+		hashAPIKey("cron-key"), hashAPIKey("old-key"), hashAPIKey("temp-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := PostgresAPIKeys(schema + ".api_keys")
+	useTools(store, &tools{pool: pool})
+
+	tests := []struct {
+		name    string
+		key     string
+		want    *Principal
+		wantErr error
+	}{
+		{"valid", "cron-key", &Principal{Scheme: "apikey", Subject: "cron", Scopes: []string{"internal"}, Roles: []string{"admin"}}, nil},
+		{"not expired", "temp-key", &Principal{Scheme: "apikey", Subject: "temp", Scopes: []string{"read"}, Roles: []string{"user"}}, nil},
+		{"expired", "old-key", nil, ErrInvalidCredentials},
+		{"unknown", "other-key", nil, ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.LookupAPIKey(ctx, tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("LookupAPIKey() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LookupAPIKey() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBasicAuthenticator(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("bob-pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := BasicAuthenticator(
+		BasicUser{Username: "alice", Password: "alice-pass"},
+		BasicUser{Username: "bob", PasswordHash: string(hash)},
+	)
+	basic := func(credentials string) metadata.MD {
+		return metadata.Pairs("authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	tests := []struct {
+		name    string
+		md      metadata.MD
+		want    string
+		wantErr error
+	}{
+		{"plain", basic("alice:alice-pass"), "alice", nil},
+		{"bcrypt", basic("bob:bob-pass"), "bob", nil},
+		{"wrong password", basic("alice:bob-pass"), "", ErrInvalidCredentials},
+		{"wrong bcrypt password", basic("bob:alice-pass"), "", ErrInvalidCredentials},
+		{"unknown user", basic("eve:pass"), "", ErrInvalidCredentials},
+		{"malformed", basic("alice"), "", ErrInvalidCredentials},
+		{"not base64", metadata.Pairs("authorization", "Basic !"), "", ErrInvalidCredentials},
+		{"missing", metadata.MD{}, "", ErrNoCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := auth.Authenticate(context.Background(), tt.md)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (p.Subject != tt.want || p.Scheme != "basic") {
+				t.Errorf("unexpected principal %+v", p)
+			}
+		})
+	}
+}
+
+// whoamiImplementation responds with subject of authenticated principal.
+type whoamiImplementation struct {
+	tools Tools
+}
+
+func (w *whoamiImplementation) UseTools(t Tools) {
+	w.tools = t
+}
+
+func whoamiServiceDesc() *grpc.ServiceDesc {
+	desc := &grpc.ServiceDesc{
+		ServiceName: "grpcapp.test.Whoami",
+		HandlerType: (*any)(nil),
+	}
+	for _, name := range []string{"Public", "Internal"} {
+		desc.Methods = append(desc.Methods, unaryMethodDesc(desc.ServiceName, name, nil, func(srv any, ctx context.Context, _ any) (any, error) {
+			p := srv.(*whoamiImplementation).tools.Principal(ctx)
+			if p == nil {
+				return wrapperspb.String(""), nil
+			}
+			return wrapperspb.String(p.Scheme + ":" + p.Subject), nil
+		}))
+	}
+	return desc
+}
+
+func Test_app_authenticators(t *testing.T) {
+	secret := []byte("secret")
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice"}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New(
+		WithConfig(&Config{LogLevel: "info"}),
+		WithAuthenticator(JwtAuthenticator(func(*jwt.Token) (any, error) {
+			return secret, nil
+		})),
+		WithAuthenticator(ChainAuthenticators(
+			APIKeyAuthenticator(StaticAPIKeys(APIKey{Subject: "cron", Key: "cron-key", Scopes: []string{"internal"}})),
+			BasicAuthenticator(BasicUser{Username: "bob", Password: "bob-pass"}),
+		), "/grpcapp.test.Whoami/Internal"),
+		WithAuthorizationPolicy(&Policy{Rules: []PolicyRule{
+			{Methods: []string{"/grpcapp.test.Whoami/Internal"}, Scopes: []string{"internal"}},
+		}}),
+		WithServiceImplementation(whoamiServiceDesc(), new(whoamiImplementation)),
+	)
+	go func() {
+		_ = a.Run(context.Background())
+	}()
+	<-a.Ready()
+	defer func() {
+		_ = a.Stop(context.Background())
+	}()
+	conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("bob:bob-pass"))
+	tests := []struct {
+		name     string
+		method   string
+		md       metadata.MD
+		want     string
+		wantCode codes.Code
+	}{
+		{"jwt", "Public", metadata.Pairs("authorization", "Bearer "+signed), "jwt:alice", codes.OK},
+		{"api key not accepted", "Public", metadata.Pairs("x-api-key", "cron-key"), "", codes.Unauthenticated},
+		{"no credentials", "Public", metadata.MD{}, "", codes.Unauthenticated},
+		{"api key", "Internal", metadata.Pairs("x-api-key", "cron-key"), "apikey:cron", codes.OK},
+		{"invalid api key", "Internal", metadata.Pairs("x-api-key", "invalid"), "", codes.Unauthenticated},
+		{"basic without scope", "Internal", metadata.Pairs("authorization", basic), "", codes.PermissionDenied},
+		{"jwt without scope", "Internal", metadata.Pairs("authorization", signed), "", codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewOutgoingContext(context.Background(), tt.md)
+			out := new(wrapperspb.StringValue)
+			err := conn.Invoke(ctx, "/grpcapp.test.Whoami/"+tt.method, new(emptypb.Empty), out)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %v, want %v", got, tt.wantCode)
+			}
+			if out.GetValue() != tt.want {
+				t.Errorf("principal = %v, want %v", out.GetValue(), tt.want)
+			}
+		})
+	}
+}
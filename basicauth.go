@@ -0,0 +1,76 @@
+package grpcapp
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/metadata"
+)
+
+// BasicUser authenticated by BasicAuthenticator.
+type BasicUser struct {
+
+	// Username of the user, principal subject.
+	Username string
+
+	// Password of the user, compared in constant time.
+	Password string
+
+	// PasswordHash of the user, bcrypt hash of the password used if Password
+	// is empty.
+	PasswordHash string
+
+	// Scopes granted to the user.
+	Scopes []string
+
+	// Roles of the user.
+	Roles []string
+}
+
+// BasicAuthenticator authenticates users with "authorization" metadata of
+// "Basic" scheme (RFC 7617).
+func BasicAuthenticator(users ...BasicUser) Authenticator {
+	byName := make(map[string]BasicUser, len(users))
+	for _, u := range users {
+		byName[u.Username] = u
+	}
+	return basicAuthenticator(byName)
+}
+
+type basicAuthenticator map[string]BasicUser
+
+func (b basicAuthenticator) Authenticate(_ context.Context, md metadata.MD) (*Principal, error) {
+	encoded, ok := authorization(md, "Basic")
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	u, ok := b[username]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if u.Password != "" {
+		ok = subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1
+	} else {
+		ok = bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{
+		Subject: u.Username,
+		Scheme:  "basic",
+		Scopes:  u.Scopes,
+		Roles:   u.Roles,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package grpcapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// ErrNoJwtToken returned by ClaimsFrom if context has no authenticated token.
+var ErrNoJwtToken = errors.New("jwt token not found in context")
+
+// ClaimsValidator may be implemented by claims type registered with WithJwtClaims
+// to validate claims after the token is verified, e.g. to require a subject.
+type ClaimsValidator interface {
+	Validate() error
+}
+
+// WithJwtClaims registers claims type T, JWT authentication parses tokens into *T
+// (validating it with Valid and ClaimsValidator if implemented), which is
+// available to handlers with ClaimsFrom[T]. Registered claims of JWKS
+// authentication are validated by JwksConfig instead of Valid.
+//
+//	type Claims struct {
+//		jwt.StandardClaims
+//		Roles  []string `json:"roles"`
+//		Tenant string   `json:"tenant"`
+//	}
+//
+//	grpcapp.New(grpcapp.WithJwtAuthentication(keyFunc), grpcapp.WithJwtClaims[Claims]())
+func WithJwtClaims[T any, PT interface {
+	*T
+	jwt.Claims
+}]() Option {
+	return &jwtClaimsOption{func() jwt.Claims {
+		return PT(new(T))
+	}}
+}
+
+type jwtClaimsOption struct {
+	newClaims func() jwt.Claims
+}
+
+func (opt *jwtClaimsOption) option(a *app) {
+	a.tools.jwtClaims = opt.newClaims
+}
+
+// ClaimsFrom returns claims of type registered with WithJwtClaims from context of
+// authenticated request.
+func ClaimsFrom[T any, PT interface {
+	*T
+	jwt.Claims
+}](ctx context.Context) (PT, error) {
+	token, ok := ctx.Value(TokenContextKey).(*jwt.Token)
+	if !ok || token == nil {
+		return nil, ErrNoJwtToken
+	}
+	claims, ok := token.Claims.(PT)
+	if !ok {
+		return nil, fmt.Errorf("jwt claims are %T, not %T", token.Claims, PT(nil))
+	}
+	return claims, nil
+}
+
+// mapClaims of token, decoded again if parsed into registered claims type (or
+// converted with JSON for introspected opaque tokens).
+func mapClaims(token *jwt.Token) (jwt.MapClaims, error) {
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		return claims, nil
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token.Raw, claims); err != nil {
+		data, jsonErr := json.Marshal(token.Claims)
+		if jsonErr != nil || json.Unmarshal(data, &claims) != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
@@ -0,0 +1,112 @@
+package grpcapp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type testClaims struct {
+	jwt.StandardClaims
+	Roles  []string `json:"roles"`
+	Tenant string   `json:"tenant"`
+}
+
+func (c *testClaims) Validate() error {
+	if c.Tenant == "" {
+		return errors.New("tenant is required")
+	}
+	return nil
+}
+
+func TestClaimsFrom(t *testing.T) {
+	claims := &testClaims{Tenant: "tenant"}
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		want    *testClaims
+		wantErr bool
+	}{
+		{"without token", context.Background(), nil, true},
+		{"map claims", context.WithValue(context.Background(), TokenContextKey, &jwt.Token{Claims: jwt.MapClaims{}}), nil, true},
+		{"typed claims", context.WithValue(context.Background(), TokenContextKey, &jwt.Token{Claims: claims}), claims, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ClaimsFrom[testClaims](tt.ctx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ClaimsFrom() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ClaimsFrom() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := ClaimsFrom[testClaims](context.Background()); !errors.Is(err, ErrNoJwtToken) {
+		t.Errorf("expected ErrNoJwtToken, got %v", err)
+	}
+}
+
+func Test_makeJwtInterceptors_claims(t *testing.T) {
+	secret := []byte("secret")
+	keyFunc := func(*jwt.Token) (any, error) {
+		return secret, nil
+	}
+	a := &app{tools: &tools{log: zap.NewNop()}}
+	WithJwtAuthentication(keyFunc).option(a)
+	WithJwtClaims[testClaims]().option(a)
+	unary, _ := makeJwtInterceptors(a.tools)
+
+	sign := func(claims jwt.Claims) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	tests := []struct {
+		name       string
+		token      string
+		want       codes.Code
+		wantClaims *testClaims
+	}{
+		{
+			"typed claims",
+			sign(&testClaims{StandardClaims: jwt.StandardClaims{Subject: "user"}, Roles: []string{"admin"}, Tenant: "tenant"}),
+			codes.OK,
+			&testClaims{StandardClaims: jwt.StandardClaims{Subject: "user"}, Roles: []string{"admin"}, Tenant: "tenant"},
+		},
+		{"claims validation failed", sign(&testClaims{StandardClaims: jwt.StandardClaims{Subject: "user"}}), codes.Unauthenticated, nil},
+		{"expired", sign(&testClaims{StandardClaims: jwt.StandardClaims{ExpiresAt: 1}, Tenant: "tenant"}), codes.Unauthenticated, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", tt.token))
+			var gotClaims *testClaims
+			var gotMap jwt.MapClaims
+			_, err := unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Svc/Method"}, func(ctx context.Context, _ any) (any, error) {
+				var err error
+				gotClaims, err = ClaimsFrom[testClaims](ctx)
+				gotMap = a.tools.JwtClaims(ctx)
+				return nil, err
+			})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("interceptor code = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(gotClaims, tt.wantClaims) {
+				t.Errorf("ClaimsFrom() = %+v, want %+v", gotClaims, tt.wantClaims)
+			}
+			if tt.wantClaims != nil && gotMap["tenant"] != tt.wantClaims.Tenant {
+				t.Errorf("JwtClaims() = %v, expected tenant %s", gotMap, tt.wantClaims.Tenant)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package grpcapp
+
+// Phase of the application lifecycle.
+type Phase string
+
+const (
+	// PhaseConfig reading configuration.
+	PhaseConfig Phase = "config"
+
+	// PhaseLogger initializing logger.
+	PhaseLogger Phase = "logger"
+
+	// PhaseTracing initializing tracing.
+	PhaseTracing Phase = "tracing"
+
+	// PhaseDatabase connecting to database.
+	PhaseDatabase Phase = "database"
+
+	// PhaseTLS loading TLS certificates.
+	PhaseTLS Phase = "tls"
+
+	// PhaseStartHook running start hooks.
+	PhaseStartHook Phase = "start hook"
+
+	// PhaseGateway registering grpc-gateway handlers.
+	PhaseGateway Phase = "gateway"
+
+	// PhaseListen opening listeners.
+	PhaseListen Phase = "listen"
+
+	// PhaseServe serving requests.
+	PhaseServe Phase = "serve"
+)
+
+// Error returned by App.Run.
+type Error struct {
+
+	// Phase where the error occurred.
+	Phase Phase
+
+	// Message describing the failure.
+	Message string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func newError(phase Phase, msg string, err error) *Error {
+	return &Error{phase, msg, err}
+}
+
+// Error implements error interface.
+func (e *Error) Error() string {
+	return string(e.Phase) + ": " + e.Message + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,41 @@
+package grpcapp
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestError_Error(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *Error
+		want string
+	}{
+		{"basic", newError(PhaseConfig, "failed to parse config", errors.New("err")), "config: failed to parse config: err"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestError_Unwrap(t *testing.T) {
+	cause := errors.New("err")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"basic", newError(PhaseServe, "failed to serve grpc", cause), cause},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, tt.want) {
+				t.Errorf("Unwrap() = %v, want %v", errors.Unwrap(tt.err), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package grpcapp
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// GatewayRegisterFunc registers grpc-gateway handlers, it matches the signature of
+// generated Register{Service}Handler functions.
+type GatewayRegisterFunc func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error
+
+// WithGateway option registers grpc-gateway handlers on the HTTP server, so REST/JSON
+// requests are transcoded according to google.api.http annotations. The handlers call
+// gRPC server in-process, so all interceptors (JWT, logging etc.) are applied. Must be
+// used together with WithHTTP option, otherwise will be ignored.
+func WithGateway(register ...GatewayRegisterFunc) Option {
+	return &gatewayOption{register}
+}
+
+type gatewayOption struct {
+	register []GatewayRegisterFunc
+}
+
+func (opt *gatewayOption) option(a *app) {
+	a.gatewayRegister = append(a.gatewayRegister, opt.register...)
+}
+
+// WithGatewayMuxOptions appends runtime.ServeMuxOption used to create grpc-gateway
+// runtime.ServeMux.
+func WithGatewayMuxOptions(options ...runtime.ServeMuxOption) Option {
+	return &gatewayMuxOptionsOption{options}
+}
+
+type gatewayMuxOptionsOption struct {
+	options []runtime.ServeMuxOption
+}
+
+func (opt *gatewayMuxOptionsOption) option(a *app) {
+	a.gatewayMuxOptions = append(a.gatewayMuxOptions, opt.options...)
+}
+
+func (a *app) initGateway() error {
+	if len(a.gatewayRegister) == 0 || a.gatewayMux != nil {
+		return nil
+	}
+	a.gatewayLis = newGatewayListener()
+	conn, err := grpc.Dial("gateway",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return a.gatewayLis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return newError(PhaseGateway, "failed to dial in-process grpc server", err)
+	}
+	a.gatewayConn = conn
+	a.gatewayMux = runtime.NewServeMux(a.gatewayMuxOptions...)
+	for i, register := range a.gatewayRegister {
+		if err = register(context.Background(), a.gatewayMux, conn); err != nil {
+			a.closeGateway()
+			return newError(PhaseGateway, "failed to register gateway handler", err)
+		}
+		a.tools.log.Info("gateway registration",
+			zap.Int("handler", i))
+	}
+	return nil
+}
+
+func (a *app) serveGateway() {
+	if err := a.grpcServer.Serve(a.gatewayLis); err != nil {
+		a.errCh <- newError(PhaseServe, "failed to serve gateway", err)
+	}
+}
+
+func (a *app) closeGateway() {
+	if a.gatewayConn != nil {
+		_ = a.gatewayConn.Close()
+		a.gatewayConn = nil
+	}
+	if a.gatewayLis != nil {
+		_ = a.gatewayLis.Close()
+	}
+}
+
+// gatewayListener accepts in-process gateway connections over net.Pipe, marked
+// so grpc server does not expect tls handshake on them.
+type gatewayListener struct {
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newGatewayListener() *gatewayListener {
+	return &gatewayListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *gatewayListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return gatewayConn{conn}, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *gatewayListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *gatewayListener) Addr() net.Addr {
+	return gatewayAddr{}
+}
+
+// DialContext connects to the listener, blocks until the connection is accepted.
+func (l *gatewayListener) DialContext(ctx context.Context) (net.Conn, error) {
+	server, client := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+		_, _ = server.Close(), client.Close()
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		_, _ = server.Close(), client.Close()
+		return nil, ctx.Err()
+	}
+}
+
+type gatewayAddr struct{}
+
+func (gatewayAddr) Network() string { return "pipe" }
+func (gatewayAddr) String() string  { return "gateway" }
+
+type gatewayConn struct {
+	net.Conn
+}
@@ -0,0 +1,163 @@
+package grpcapp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// registerHealthGateway mimics a generated Register{Service}Handler function.
+func registerHealthGateway(_ context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error {
+	client := healthpb.NewHealthClient(conn)
+	return mux.HandlePath(http.MethodGet, "/v1/health", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		ctx := r.Context()
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+		res, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+		runtime.ForwardResponseMessage(ctx, mux, outbound, w, r, res)
+	})
+}
+
+func TestWithGateway(t *testing.T) {
+	a := &app{}
+	WithGateway(registerHealthGateway, registerHealthGateway).option(a)
+	WithGatewayMuxOptions(runtime.WithDisablePathLengthFallback()).option(a)
+	if len(a.gatewayRegister) != 2 {
+		t.Errorf("expected 2 gateway register funcs, got %d", len(a.gatewayRegister))
+	}
+	if len(a.gatewayMuxOptions) != 1 {
+		t.Errorf("expected 1 gateway mux option, got %d", len(a.gatewayMuxOptions))
+	}
+}
+
+func Test_app_gateway(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	a := New(
+		WithConfig(&Config{LogLevel: "info", TLSCertificate: certFile, TLSKey: keyFile}),
+		WithHTTP(),
+		WithGateway(registerHealthGateway),
+	).(*app)
+	go func() {
+		_ = a.Run(context.Background())
+	}()
+	<-a.Ready()
+	defer func() {
+		_ = a.Stop(context.Background())
+	}()
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+
+	// REST request
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	res, err := client.Get("https://" + a.HttpAddr().String() + "/v1/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), `"SERVING"`) {
+		t.Errorf("unexpected response %d: %s", res.StatusCode, body)
+	}
+
+	// native gRPC request on the same port
+	conn, err := grpc.Dial(a.HttpAddr().String(), grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if _, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// both requests went through interceptors
+	if got := testutil.ToFloat64(a.metrics.handled.WithLabelValues("grpc.health.v1.Health", "Check", "OK")); got != 2 {
+		t.Errorf("expected 2 handled calls, got %v", got)
+	}
+}
+
+func Test_app_initGateway(t *testing.T) {
+	failing := func(_ context.Context, _ *runtime.ServeMux, _ *grpc.ClientConn) error {
+		return errors.New("err")
+	}
+	a := New(WithConfig(&Config{}), WithGateway(failing)).(*app)
+	a.tools.log = zap.NewNop()
+	err := a.initGateway()
+	var appErr *Error
+	if !errors.As(err, &appErr) || appErr.Phase != PhaseGateway {
+		t.Errorf("initGateway() error = %v, want gateway phase error", err)
+	}
+}
+
+func Test_gatewayListener(t *testing.T) {
+	lis := newGatewayListener()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- conn
+	}()
+	client, err := lis.DialContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := <-accepted
+	if _, ok := server.(gatewayConn); !ok {
+		t.Errorf("accepted connection is %T, want gatewayConn", server)
+	}
+	go func() {
+		_, _ = client.Write([]byte("ping"))
+	}()
+	buf := make([]byte, 4)
+	if _, err = io.ReadFull(server, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("read %q, %v", buf, err)
+	}
+	_, _ = client.Close(), server.Close()
+
+	if err = lis.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = lis.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Accept() error = %v, want net.ErrClosed", err)
+	}
+	if _, err = lis.DialContext(context.Background()); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("DialContext() error = %v, want net.ErrClosed", err)
+	}
+}
+
+func Test_app_gatewayStartFailure(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	a := New(
+		WithConfig(&Config{LogLevel: "info", TLSCertificate: certFile, TLSKey: keyFile}),
+		WithHTTP(),
+		WithGateway(registerHealthGateway),
+		WithStartHook(func(App) error { return errors.New("failed") }),
+	).(*app)
+	if err := a.Run(context.Background()); err == nil {
+		t.Fatal("Run() expected error")
+	}
+	if a.gatewayConn != nil {
+		t.Error("expected gateway connection to be closed")
+	}
+	if _, err := a.gatewayLis.DialContext(context.Background()); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("DialContext() error = %v, want net.ErrClosed", err)
+	}
+}
@@ -0,0 +1,49 @@
+package grpcapp
+
+import (
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+)
+
+// WithGrpcWeb option enables gRPC-Web (binary and text modes) on the HTTP server
+// alongside native gRPC, so services can be called from browsers. CORS is
+// configured with GrpcWebAllowedOrigins and GrpcWebAllowedHeaders in Config. Must
+// be used together with WithHTTP option, otherwise will be ignored.
+func WithGrpcWeb() Option {
+	return new(grpcWebOption)
+}
+
+type grpcWebOption struct{}
+
+func (*grpcWebOption) option(a *app) {
+	a.grpcWebEnabled = true
+}
+
+func (a *app) initGrpcWeb() {
+	if !a.grpcWebEnabled || a.grpcWeb != nil {
+		return
+	}
+	opts := []grpcweb.Option{
+		grpcweb.WithOriginFunc(allowedOrigin(a.tools.cfg.GrpcWebAllowedOrigins)),
+	}
+	if len(a.tools.cfg.GrpcWebAllowedHeaders) > 0 {
+		opts = append(opts, grpcweb.WithAllowedRequestHeaders(a.tools.cfg.GrpcWebAllowedHeaders))
+	}
+	a.grpcWeb = grpcweb.WrapServer(a.grpcServer, opts...)
+}
+
+// allowedOrigin returns a function reporting whether origin is in origins list,
+// "*" allows any origin.
+func allowedOrigin(origins []string) func(string) bool {
+	allowed := make(map[string]struct{}, len(origins))
+	for _, origin := range origins {
+		allowed[origin] = struct{}{}
+	}
+	_, anyOrigin := allowed["*"]
+	return func(origin string) bool {
+		if anyOrigin {
+			return true
+		}
+		_, ok := allowed[origin]
+		return ok
+	}
+}
@@ -0,0 +1,181 @@
+package grpcapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestWithGrpcWeb(t *testing.T) {
+	a := &app{}
+	WithGrpcWeb().option(a)
+	if !a.grpcWebEnabled {
+		t.Error("expected grpc-web to be enabled")
+	}
+}
+
+func Test_allowedOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		origins []string
+		origin  string
+		want    bool
+	}{
+		{"empty", nil, "https://example.com", false},
+		{"allowed", []string{"https://example.com"}, "https://example.com", true},
+		{"not allowed", []string{"https://example.com"}, "https://other.com", false},
+		{"any", []string{"*"}, "https://other.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowedOrigin(tt.origins)(tt.origin); got != tt.want {
+				t.Errorf("allowedOrigin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// grpcWebFrame encodes msg as a gRPC-Web data frame.
+func grpcWebFrame(t *testing.T, msg proto.Message) []byte {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	return append(frame, data...)
+}
+
+func Test_app_grpcWeb(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	a := New(
+		WithConfig(&Config{
+			LogLevel:              "info",
+			TLSCertificate:        certFile,
+			TLSKey:                keyFile,
+			GrpcWebAllowedOrigins: []string{"https://example.com"},
+		}),
+		WithHTTP(),
+		WithGrpcWeb(),
+	)
+	go func() {
+		_ = a.Run(context.Background())
+	}()
+	<-a.Ready()
+	defer func() {
+		_ = a.Stop(context.Background())
+	}()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	url := "https://" + a.HttpAddr().String()
+	frame := grpcWebFrame(t, &healthpb.HealthCheckRequest{})
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		decode      func([]byte) []byte
+	}{
+		{"binary", "application/grpc-web+proto", frame, func(b []byte) []byte { return b }},
+		{"text", "application/grpc-web-text", []byte(base64.StdEncoding.EncodeToString(frame)), func(b []byte) []byte {
+			// every flushed chunk is encoded and padded separately.
+			var d []byte
+			for len(b) >= 4 {
+				n := 4
+				for n < len(b) && b[n-1] != '=' {
+					n += 4
+				}
+				chunk, err := base64.StdEncoding.DecodeString(string(b[:n]))
+				if err != nil {
+					t.Fatal(err)
+				}
+				d, b = append(d, chunk...), b[n:]
+			}
+			return d
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, url+"/grpc.health.v1.Health/Check", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("X-Grpc-Web", "1")
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			_ = res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", res.StatusCode)
+			}
+			body = tt.decode(body)
+			if !bytes.Contains(body, []byte("grpc-status: 0")) {
+				t.Errorf("expected grpc-status 0 in trailers, got %q", body)
+			}
+			var msg healthpb.HealthCheckResponse
+			n := binary.BigEndian.Uint32(body[1:5])
+			if err = proto.Unmarshal(body[5:5+n], &msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Status != healthpb.HealthCheckResponse_SERVING {
+				t.Errorf("expected SERVING, got %v", msg.Status)
+			}
+		})
+	}
+
+	t.Run("server streaming", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url+"/grpc.health.v1.Health/Watch", bytes.NewReader(frame))
+		req.Header.Set("Content-Type", "application/grpc-web+proto")
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = res.Body.Close()
+		}()
+		header := make([]byte, 5)
+		if _, err = io.ReadFull(res.Body, header); err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+		if _, err = io.ReadFull(res.Body, data); err != nil {
+			t.Fatal(err)
+		}
+		var msg healthpb.HealthCheckResponse
+		if err = proto.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Status != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("expected SERVING, got %v", msg.Status)
+		}
+	})
+
+	for _, origin := range []string{"https://example.com", "https://other.com"} {
+		t.Run("cors "+origin, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodOptions, url+"/grpc.health.v1.Health/Check", nil)
+			req.Header.Set("Origin", origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = res.Body.Close()
+			allowed := res.Header.Get("Access-Control-Allow-Origin") == origin
+			if want := !strings.Contains(origin, "other"); allowed != want {
+				t.Errorf("expected origin allowed %v, got %v", want, allowed)
+			}
+		})
+	}
+}
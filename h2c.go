@@ -0,0 +1,79 @@
+package grpcapp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// httpH2C reports whether HTTP server should serve cleartext HTTP/2 (h2c) and
+// HTTP/1.1: TLS is not configured and HttpAllowH2C is explicitly set.
+func (a *app) httpH2C() bool {
+	cfg := a.tools.cfg
+	return cfg.HttpAllowH2C && cfg.TLSCertificate == "" && cfg.TLSKey == ""
+}
+
+// h2cHandler wraps h to accept h2c connections (with prior knowledge or
+// HTTP/1.1 upgrade) and configures HTTP server to send GOAWAY to them on
+// shutdown.
+func (a *app) h2cHandler(h http.Handler) (http.Handler, error) {
+	h2s := &http2.Server{}
+	if err := http2.ConfigureServer(a.httpServer, h2s); err != nil {
+		return nil, newError(PhaseListen, "failed to configure h2c", err)
+	}
+	a.h2cClosing = make(chan struct{})
+	a.h2cCloseOnce = new(sync.Once)
+	h = h2c.NewHandler(h, h2s)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// h2c connections are hijacked from HTTP server, so closing it does
+		// not cancel their requests
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go func() {
+			select {
+			case <-a.h2cClosing:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	}), nil
+}
+
+// closeH2C cancels requests on hijacked h2c connections.
+func (a *app) closeH2C() {
+	if a.h2cCloseOnce != nil {
+		a.h2cCloseOnce.Do(func() {
+			close(a.h2cClosing)
+		})
+	}
+}
+
+func (a *app) serveHttpH2C(lis net.Listener) {
+	if err := a.httpServer.Serve(lis); err != nil && err != http.ErrServerClosed && !isMuxClosed(err) {
+		a.errCh <- newError(PhaseServe, "failed to serve http", err)
+	}
+}
+
+// waitHttpRequests waits for HTTP handlers to return, cancelling the ones
+// left on h2c connections if ctx is done.
+func (a *app) waitHttpRequests(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		a.httpRequests.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		a.tools.log.Warn("shutdown timeout exceeded, cancelling h2c requests",
+			zap.Duration("timeout", a.tools.cfg.ShutdownTimeout))
+		a.closeH2C()
+		<-done
+	}
+}
@@ -0,0 +1,116 @@
+package grpcapp
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func Test_app_httpH2C(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *Config
+		want bool
+	}{
+		{"not allowed", &Config{}, false},
+		{"allowed", &Config{HttpAllowH2C: true}, true},
+		{"tls certificate set", &Config{HttpAllowH2C: true, TLSCertificate: "cert.pem"}, false},
+		{"tls key set", &Config{HttpAllowH2C: true, TLSKey: "key.pem"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &app{tools: &tools{cfg: tt.cfg}}
+			if got := a.httpH2C(); got != tt.want {
+				t.Errorf("httpH2C() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_app_h2c(t *testing.T) {
+	a := New(
+		WithConfig(&Config{LogLevel: "info", HttpAllowH2C: true, ShutdownTimeout: time.Second}),
+		WithHTTP(),
+		WithGateway(registerHealthGateway),
+	).(*app)
+	go func() {
+		_ = a.Run(context.Background())
+	}()
+	<-a.Ready()
+	url := "http://" + a.HttpAddr().String() + "/v1/health"
+
+	h2cClient := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	tests := []struct {
+		name      string
+		client    *http.Client
+		wantProto int
+	}{
+		{"http/1.1", http.DefaultClient, 1},
+		{"h2c", h2cClient, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.client.Get(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			_ = res.Body.Close()
+			if res.ProtoMajor != tt.wantProto {
+				t.Errorf("expected HTTP/%d, got %s", tt.wantProto, res.Proto)
+			}
+			if res.StatusCode != http.StatusOK || !strings.Contains(string(body), `"SERVING"`) {
+				t.Errorf("unexpected response %d: %s", res.StatusCode, body)
+			}
+		})
+	}
+
+	// native gRPC over h2c on the same port
+	conn, err := grpc.Dial(a.HttpAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	client := healthpb.NewHealthClient(conn)
+	if _, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// shutdown is not blocked by a stream left open on h2c connection
+	stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan error)
+	go func() {
+		stopped <- a.Stop(context.Background())
+	}()
+	select {
+	case err = <-stopped:
+		if err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("app did not stop")
+	}
+}
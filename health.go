@@ -0,0 +1,136 @@
+package grpcapp
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// DefaultHealthCheckInterval is used when Config.HealthCheckInterval is not set.
+const DefaultHealthCheckInterval = 10 * time.Second
+
+// HealthChecker checks a dependency of the application. If any HealthChecker returns
+// an error, all services are reported as NOT_SERVING until the next successful check.
+type HealthChecker func(ctx context.Context) error
+
+// WithHealthChecker appends HealthChecker polled periodically by the built-in gRPC
+// health service. When database is initialized, it is checked by default.
+func WithHealthChecker(name string, checker HealthChecker) Option {
+	return &healthCheckerOption{name, checker}
+}
+
+type healthCheckerOption struct {
+	name    string
+	checker HealthChecker
+}
+
+type healthChecker struct {
+	name    string
+	checker HealthChecker
+}
+
+func (opt *healthCheckerOption) option(a *app) {
+	if opt.checker != nil {
+		a.healthCheckers = append(a.healthCheckers, healthChecker{
+			name:    opt.name,
+			checker: opt.checker,
+		})
+	}
+}
+
+func (a *app) initHealth() {
+	if _, ok := a.grpcServer.GetServiceInfo()[healthpb.Health_ServiceDesc.ServiceName]; ok {
+		a.tools.log.Info("health service already registered")
+		return
+	}
+	a.health = health.NewServer()
+	a.setServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(a.grpcServer, a.health)
+
+	if a.tools.pool != nil || a.tools.db != nil {
+		a.healthCheckers = append([]healthChecker{{
+			name:    "database",
+			checker: a.pingDatabase,
+		}}, a.healthCheckers...)
+	}
+}
+
+// healthMethod reports whether method is of the health service, which is
+// neither authenticated nor authorized, so probes of kubelet and load
+// balancers do not need credentials.
+func healthMethod(method string) bool {
+	return strings.HasPrefix(method, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
+
+func (a *app) pingDatabase(ctx context.Context) error {
+	if a.tools.pool != nil {
+		return a.tools.pool.Ping(ctx)
+	}
+	return a.tools.db.Ping(ctx)
+}
+
+func (a *app) startHealthChecks() {
+	if a.health == nil {
+		return
+	}
+	interval := a.tools.cfg.HealthCheckInterval
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	var ctx context.Context
+	ctx, a.healthCancel = context.WithCancel(context.Background())
+	a.checkHealth(ctx, interval)
+	if len(a.healthCheckers) > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					a.checkHealth(ctx, interval)
+				}
+			}
+		}()
+	}
+}
+
+func (a *app) checkHealth(ctx context.Context, timeout time.Duration) {
+	status := healthpb.HealthCheckResponse_SERVING
+	for _, hc := range a.healthCheckers {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := hc.checker(checkCtx)
+		cancel()
+		if err != nil {
+			a.tools.log.Warn("health check failed",
+				zap.String("checker", hc.name),
+				zap.Error(err))
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	a.setServingStatus(status)
+}
+
+func (a *app) setServingStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	a.health.SetServingStatus("", status)
+	for _, si := range a.serviceImplementations {
+		a.health.SetServingStatus(si.desc.ServiceName, status)
+	}
+}
+
+// stopHealth reports all services as NOT_SERVING and stops health checks.
+func (a *app) stopHealth() {
+	if a.health == nil {
+		return
+	}
+	if a.healthCancel != nil {
+		a.healthCancel()
+	}
+	a.health.Shutdown()
+	a.tools.log.Info("health status set to not serving")
+}
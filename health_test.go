@@ -0,0 +1,147 @@
+package grpcapp
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestWithHealthChecker(t *testing.T) {
+	checker := func(_ context.Context) error { return nil }
+	tests := []struct {
+		name    string
+		checker HealthChecker
+		wantLen int
+	}{
+		{"with checker", checker, 1},
+		{"without checker", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &app{}
+			WithHealthChecker("test", tt.checker).option(a)
+			if len(a.healthCheckers) != tt.wantLen {
+				t.Errorf("expected %d health checkers, got %d", tt.wantLen, len(a.healthCheckers))
+			}
+		})
+	}
+}
+
+func Test_app_health(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	checker := func(_ context.Context) error {
+		if !healthy.Load() {
+			return fmt.Errorf("unhealthy")
+		}
+		return nil
+	}
+	a := New(
+		WithConfig(&Config{LogLevel: "info", HealthCheckInterval: time.Millisecond * 50}),
+		WithServiceImplementation(&blockingServiceDesc, blockingImplementation{}),
+		WithHealthChecker("test", checker),
+	).(*app)
+	go func() {
+		_ = a.Run(context.Background())
+	}()
+	<-a.Ready()
+
+	conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	client := healthpb.NewHealthClient(conn)
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		res, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("Check(%q) error = %v", service, err)
+		}
+		return res.Status
+	}
+
+	for _, service := range []string{"", blockingServiceDesc.ServiceName} {
+		if got := check(service); got != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Check(%q) = %v, want SERVING", service, got)
+		}
+	}
+
+	healthy.Store(false)
+	<-time.After(time.Millisecond * 200)
+	if got := check(blockingServiceDesc.ServiceName); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Check() = %v, want NOT_SERVING", got)
+	}
+
+	healthy.Store(true)
+	<-time.After(time.Millisecond * 200)
+	if got := check(blockingServiceDesc.ServiceName); got != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Check() = %v, want SERVING", got)
+	}
+
+	if err = a.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	res, err := a.health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Check() after stop = %v, want NOT_SERVING", res.Status)
+	}
+}
+
+func Test_app_healthAuthentication(t *testing.T) {
+	keyFunc := func(*jwt.Token) (any, error) {
+		return []byte("secret"), nil
+	}
+	tests := []struct {
+		name    string
+		options []Option
+	}{
+		{"jwt", []Option{WithJwtAuthentication(keyFunc)}},
+		{"authenticator", []Option{WithAuthenticator(JwtAuthenticator(keyFunc))}},
+		{"deny unmatched policy", []Option{
+			WithJwtAuthentication(keyFunc),
+			WithAuthorizationPolicy(&Policy{DenyUnmatched: true}),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(append(tt.options, WithConfig(&Config{LogLevel: "info"}))...).(*app)
+			go func() {
+				_ = a.Run(context.Background())
+			}()
+			<-a.Ready()
+			defer func() {
+				_ = a.Stop(context.Background())
+			}()
+			conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+			client := healthpb.NewHealthClient(conn)
+			if _, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+				t.Errorf("Check() error = %v", err)
+			}
+			stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			if err != nil {
+				t.Errorf("Watch() error = %v", err)
+			}
+		})
+	}
+}
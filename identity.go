@@ -0,0 +1,187 @@
+package grpcapp
+
+import (
+	"context"
+	"path"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// PeerIdentity of a client verified by its TLS certificate (mutual TLS).
+type PeerIdentity struct {
+
+	// Subject distinguished name of the client certificate.
+	Subject string
+
+	// CommonName from the certificate subject.
+	CommonName string
+
+	// DNSNames subject alternative names.
+	DNSNames []string
+
+	// EmailAddresses subject alternative names.
+	EmailAddresses []string
+
+	// URIs subject alternative names.
+	URIs []string
+
+	// SpiffeID from the first URI subject alternative name with "spiffe"
+	// scheme or empty.
+	SpiffeID string
+}
+
+// names returns all identity names patterns are matched against.
+func (p *PeerIdentity) names() []string {
+	names := make([]string, 0, 1+len(p.DNSNames)+len(p.EmailAddresses)+len(p.URIs))
+	if p.CommonName != "" {
+		names = append(names, p.CommonName)
+	}
+	names = append(names, p.DNSNames...)
+	names = append(names, p.EmailAddresses...)
+	return append(names, p.URIs...)
+}
+
+// peerIdentity from grpc peer of ctx or nil if client certificate is not
+// verified. Calls made through grpc-gateway have no peer identity.
+func peerIdentity(ctx context.Context) *PeerIdentity {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := info.State.VerifiedChains[0][0]
+	identity := &PeerIdentity{
+		Subject:        cert.Subject.String(),
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+	}
+	for _, u := range cert.URIs {
+		identity.URIs = append(identity.URIs, u.String())
+		if u.Scheme == "spiffe" && identity.SpiffeID == "" {
+			identity.SpiffeID = u.String()
+		}
+	}
+	return identity
+}
+
+// WithPeerAuthorization allows calls to provided methods only for clients whose verified
+// certificate identity (common name, DNS, email or URI SAN, including SPIFFE ID) matches
+// one of patterns, others are denied. Patterns use path.Match syntax, e.g.
+// "spiffe://example.org/ns/*/sa/frontend". If not methods provided, the authorization
+// will be enabled for all requests. Methods may be path.Match patterns as well, e.g.
+// "/pkg.Greeter/*". Calls of the health service (grpc.health.v1.Health) are always
+// allowed. Requires mutual TLS, see Config.TLSClientCA, calls made through
+// grpc-gateway have no peer identity and are denied.
+func WithPeerAuthorization(patterns []string, methods ...string) Option {
+	return &peerAuthOption{patterns, methods}
+}
+
+type peerAuthOption struct {
+	patterns []string
+	methods  []string
+}
+
+func (opt *peerAuthOption) option(a *app) {
+	a.peerAuth = append(a.peerAuth, peerAuthRule{opt.patterns, opt.methods})
+}
+
+type peerAuthRule struct {
+	patterns []string
+	methods  []string
+}
+
+// allows reports whether the rule applies to method and identity matches it.
+func (r peerAuthRule) allows(method string, identity *PeerIdentity) (applies bool, allowed bool) {
+	if len(r.methods) > 0 && !matchMethod(r.methods, method) {
+		return false, true
+	}
+	if identity == nil {
+		return true, false
+	}
+	for _, pattern := range r.patterns {
+		for _, name := range identity.names() {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true, true
+			}
+		}
+	}
+	return true, false
+}
+
+// initPeerAuth fails on malformed method or identity patterns of peer
+// authorization rules.
+func (a *app) initPeerAuth() error {
+	for _, rule := range a.peerAuth {
+		if err := checkPatterns(rule.methods); err != nil {
+			return newError(PhaseConfig, "invalid peer authorization methods", err)
+		}
+		if err := checkPatterns(rule.patterns); err != nil {
+			return newError(PhaseConfig, "invalid peer authorization identities", err)
+		}
+	}
+	return nil
+}
+
+func makePeerAuthInterceptors(rules []peerAuthRule, log *zap.Logger) (
+	grpc.UnaryServerInterceptor,
+	grpc.StreamServerInterceptor,
+) {
+	authorize := func(ctx context.Context, method string) error {
+		if healthMethod(method) {
+			return nil
+		}
+		identity := peerIdentity(ctx)
+		for _, rule := range rules {
+			applies, allowed := rule.allows(method, identity)
+			if !applies || allowed {
+				continue
+			}
+			if identity == nil {
+				log.Debug("client certificate not verified",
+					zap.String("method", method))
+				return status.Error(codes.Unauthenticated, "unauthenticated")
+			}
+			log.Warn("peer identity not allowed",
+				zap.String("method", method),
+				zap.String("subject", identity.Subject),
+				zap.Strings("names", identity.names()))
+			return status.Error(codes.PermissionDenied, "permission denied")
+		}
+		return nil
+	}
+
+	unaryInterceptor := func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		if err := authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+
+	streamInterceptor := func(
+		srv any,
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := authorize(stream.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+
+	return unaryInterceptor, streamInterceptor
+}
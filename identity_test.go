@@ -0,0 +1,190 @@
+package grpcapp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func Test_peerIdentity(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.keyPair(t, "client", "https://example.org", "spiffe://example.org/ns/default/sa/frontend")
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsPeer := func(chains [][]*x509.Certificate) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{
+			AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: chains}},
+		})
+	}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want *PeerIdentity
+	}{
+		{"without peer", context.Background(), nil},
+		{"plaintext", peer.NewContext(context.Background(), &peer.Peer{}), nil},
+		{"not verified", tlsPeer(nil), nil},
+		{"verified", tlsPeer([][]*x509.Certificate{{leaf, ca.cert}}), &PeerIdentity{
+			Subject:    "CN=client",
+			CommonName: "client",
+			DNSNames:   []string{"client"},
+			URIs:       []string{"https://example.org", "spiffe://example.org/ns/default/sa/frontend"},
+			SpiffeID:   "spiffe://example.org/ns/default/sa/frontend",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (&tools{}).PeerIdentity(tt.ctx); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PeerIdentity() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_peerAuthRule_allows(t *testing.T) {
+	identity := &PeerIdentity{
+		CommonName: "client",
+		DNSNames:   []string{"client.example.com"},
+		URIs:       []string{"spiffe://example.org/ns/default/sa/frontend"},
+	}
+	tests := []struct {
+		name        string
+		rule        peerAuthRule
+		identity    *PeerIdentity
+		wantApplies bool
+		wantAllowed bool
+	}{
+		{"other method", peerAuthRule{[]string{"other"}, []string{"/pkg.Svc/Other"}}, identity, false, true},
+		{"common name", peerAuthRule{[]string{"client"}, []string{"/pkg.Svc/Method"}}, identity, true, true},
+		{"method pattern", peerAuthRule{[]string{"other"}, []string{"/pkg.Svc/*"}}, identity, true, false},
+		{"other method pattern", peerAuthRule{[]string{"other"}, []string{"/pkg.Other/*"}}, identity, false, true},
+		{"dns wildcard", peerAuthRule{[]string{"*.example.com"}, nil}, identity, true, true},
+		{"spiffe wildcard", peerAuthRule{[]string{"spiffe://example.org/ns/*/sa/frontend"}, nil}, identity, true, true},
+		{"not matched", peerAuthRule{[]string{"spiffe://example.org/ns/*/sa/backend"}, nil}, identity, true, false},
+		{"without identity", peerAuthRule{[]string{"*"}, nil}, nil, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applies, allowed := tt.rule.allows("/pkg.Svc/Method", tt.identity)
+			if applies != tt.wantApplies || allowed != tt.wantAllowed {
+				t.Errorf("allows() = %v, %v, want %v, %v", applies, allowed, tt.wantApplies, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func Test_app_peerAuthorization(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	certPEM, keyPEM := ca.issue(t, "localhost")
+	writeTestFile(t, certFile, certPEM)
+	writeTestFile(t, keyFile, keyPEM)
+	writeTestFile(t, caFile, ca.pem)
+
+	identities := make(chan *PeerIdentity, 10)
+	var a App
+	a = New(
+		WithConfig(&Config{LogLevel: "info", TLSCertificate: certFile, TLSKey: keyFile, TLSClientCA: caFile}),
+		WithPeerAuthorization([]string{"spiffe://example.org/ns/*/sa/frontend"}),
+		WithServiceImplementation(whoamiServiceDesc(), new(whoamiImplementation)),
+		WithUnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			identities <- a.(*app).tools.PeerIdentity(ctx)
+			return handler(ctx, req)
+		}),
+	)
+	go func() {
+		_ = a.Run(context.Background())
+	}()
+	<-a.Ready()
+	defer func() {
+		_ = a.Stop(context.Background())
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	dial := func(t *testing.T, cert tls.Certificate) *grpc.ClientConn {
+		conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: []tls.Certificate{cert},
+		})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		return conn
+	}
+
+	tests := []struct {
+		name     string
+		spiffeID string
+		want     codes.Code
+	}{
+		{"allowed", "spiffe://example.org/ns/default/sa/frontend", codes.OK},
+		{"denied", "spiffe://example.org/ns/default/sa/backend", codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dial(t, ca.keyPair(t, "client", tt.spiffeID))
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			err := conn.Invoke(ctx, "/grpcapp.test.Whoami/Internal", new(emptypb.Empty), new(wrapperspb.StringValue))
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("Internal() code = %v, want %v", got, tt.want)
+			}
+			if identity := <-identities; identity == nil || identity.SpiffeID != tt.spiffeID {
+				t.Errorf("expected peer identity %s, got %+v", tt.spiffeID, identity)
+			}
+
+			// health service is never authorized
+			if _, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+				t.Errorf("Check() error = %v", err)
+			}
+			<-identities
+		})
+	}
+}
+
+func Test_app_initPeerAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    peerAuthRule
+		wantErr bool
+	}{
+		{"valid", peerAuthRule{[]string{"spiffe://example.org/*"}, []string{"/pkg.Svc/*"}}, false},
+		{"invalid method", peerAuthRule{[]string{"client"}, []string{"/pkg.Svc/["}}, true},
+		{"invalid identity", peerAuthRule{[]string{"client["}, nil}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &app{peerAuth: []peerAuthRule{tt.rule}}
+			err := a.initPeerAuth()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("initPeerAuth() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var appErr *Error
+			if err != nil && (!errors.As(err, &appErr) || appErr.Phase != PhaseConfig) {
+				t.Errorf("initPeerAuth() error = %v, want config phase error", err)
+			}
+		})
+	}
+}
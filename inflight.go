@@ -0,0 +1,68 @@
+package grpcapp
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// inflight keeps track of gRPC calls being currently handled, so that calls cut
+// by a forced shutdown can be reported.
+type inflight struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func newInflight() *inflight {
+	return &inflight{calls: make(map[string]int)}
+}
+
+func (f *inflight) begin(method string) {
+	f.mu.Lock()
+	f.calls[method]++
+	f.mu.Unlock()
+}
+
+func (f *inflight) end(method string) {
+	f.mu.Lock()
+	if f.calls[method]--; f.calls[method] <= 0 {
+		delete(f.calls, method)
+	}
+	f.mu.Unlock()
+}
+
+// snapshot returns a copy of in-flight calls by method and the total count.
+func (f *inflight) snapshot() (map[string]int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := make(map[string]int, len(f.calls))
+	total := 0
+	for method, n := range f.calls {
+		calls[method] = n
+		total += n
+	}
+	return calls, total
+}
+
+func (f *inflight) unaryInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	f.begin(info.FullMethod)
+	defer f.end(info.FullMethod)
+	return handler(ctx, req)
+}
+
+func (f *inflight) streamInterceptor(
+	srv any,
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	f.begin(info.FullMethod)
+	defer f.end(info.FullMethod)
+	return handler(srv, stream)
+}
@@ -0,0 +1,69 @@
+package grpcapp
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func Test_inflight_snapshot(t *testing.T) {
+	tests := []struct {
+		name      string
+		begin     []string
+		end       []string
+		wantCalls map[string]int
+		wantTotal int
+	}{
+		{"empty", nil, nil, map[string]int{}, 0},
+		{"in flight", []string{"/a/A", "/a/A", "/b/B"}, nil, map[string]int{"/a/A": 2, "/b/B": 1}, 3},
+		{"finished", []string{"/a/A", "/b/B"}, []string{"/a/A"}, map[string]int{"/b/B": 1}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newInflight()
+			for _, m := range tt.begin {
+				f.begin(m)
+			}
+			for _, m := range tt.end {
+				f.end(m)
+			}
+			calls, total := f.snapshot()
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("snapshot() calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("snapshot() total = %v, want %v", total, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func Test_inflight_unaryInterceptor(t *testing.T) {
+	f := newInflight()
+	info := &grpc.UnaryServerInfo{FullMethod: "/a/A"}
+	_, _ = f.unaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		if _, total := f.snapshot(); total != 1 {
+			t.Errorf("expected 1 call in flight, got %d", total)
+		}
+		return nil, nil
+	})
+	if _, total := f.snapshot(); total != 0 {
+		t.Errorf("expected no calls in flight, got %d", total)
+	}
+}
+
+func Test_inflight_streamInterceptor(t *testing.T) {
+	f := newInflight()
+	info := &grpc.StreamServerInfo{FullMethod: "/a/A"}
+	_ = f.streamInterceptor(nil, nil, info, func(srv any, stream grpc.ServerStream) error {
+		if _, total := f.snapshot(); total != 1 {
+			t.Errorf("expected 1 call in flight, got %d", total)
+		}
+		return nil
+	})
+	if _, total := f.snapshot(); total != 0 {
+		t.Errorf("expected no calls in flight, got %d", total)
+	}
+}
@@ -0,0 +1,272 @@
+package grpcapp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+)
+
+// IntrospectionConfig of WithTokenIntrospection option.
+type IntrospectionConfig struct {
+
+	// URL of OAuth2 token introspection endpoint (RFC 7662), required.
+	URL string
+
+	// ClientID of client credentials authenticating introspection requests
+	// with HTTP Basic scheme, requests are not authenticated if empty.
+	ClientID string
+
+	// ClientSecret of client credentials.
+	ClientSecret string
+
+	// Issuer expected in "iss" claim, not validated if empty.
+	Issuer string
+
+	// Audience expected in "aud" claim, not validated if empty.
+	Audience string
+
+	// ClockSkew tolerated when validating "exp" and "nbf" claims.
+	ClockSkew time.Duration
+
+	// MaxCacheTTL of active tokens, which are cached until their expiration
+	// but at most MaxCacheTTL (default 5m) to notice revoked tokens.
+	MaxCacheTTL time.Duration
+
+	// NegativeCacheTTL of inactive or invalid tokens (default 10s). Failed
+	// introspection requests are not cached.
+	NegativeCacheTTL time.Duration
+
+	// HTTPClient to call introspection endpoint with (http.DefaultClient if nil).
+	HTTPClient *http.Client
+}
+
+// WithTokenIntrospection enables authentication of opaque access tokens for provided
+// methods (all methods if empty) with OAuth2 token introspection endpoint. Claims
+// of introspection response are available with Tools.JwtClaims as claims of JWT
+// (token is not signed, Tools.JwtToken has only Raw and Claims set).
+func WithTokenIntrospection(cfg IntrospectionConfig, methods ...string) Option {
+	return &introspectionOption{cfg, methods}
+}
+
+type introspectionOption struct {
+	cfg     IntrospectionConfig
+	methods []string
+}
+
+func (opt *introspectionOption) option(a *app) {
+	a.tools.jwt = &jwtData{
+		methods:       opt.methods,
+		introspection: newIntrospection(opt.cfg),
+	}
+}
+
+// IntrospectionAuthenticator is JwtAuthenticator authenticating opaque access tokens
+// with token introspection endpoint like WithTokenIntrospection option.
+func IntrospectionAuthenticator(cfg IntrospectionConfig) Authenticator {
+	return &jwtAuthenticator{jwt: &jwtData{introspection: newIntrospection(cfg)}}
+}
+
+// maxIntrospectionCache entries, expired entries are dropped when exceeded.
+const maxIntrospectionCache = 10000
+
+// errTokenRejected wraps errors of inactive or invalid tokens, which are
+// negatively cached.
+var errTokenRejected = errors.New("token rejected")
+
+// introspection caches results of token introspection by token hash.
+type introspection struct {
+	cfg IntrospectionConfig
+	log *zap.Logger
+	now func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]introspectionResult
+}
+
+type introspectionResult struct {
+	claims  jwt.MapClaims
+	err     error
+	expires time.Time
+}
+
+func newIntrospection(cfg IntrospectionConfig) *introspection {
+	if cfg.MaxCacheTTL == 0 {
+		cfg.MaxCacheTTL = 5 * time.Minute
+	}
+	if cfg.NegativeCacheTTL == 0 {
+		cfg.NegativeCacheTTL = 10 * time.Second
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	return &introspection{
+		cfg:   cfg,
+		log:   zap.NewNop(),
+		now:   time.Now,
+		cache: make(map[string]introspectionResult),
+	}
+}
+
+// checkConfig fails on IntrospectionConfig without valid endpoint URL.
+func (i *introspection) checkConfig() error {
+	if i.cfg.URL == "" {
+		return errors.New("introspection url is required")
+	}
+	return checkHTTPURL(i.cfg.URL)
+}
+
+// token of introspected raw token with claims of registered type if newClaims is
+// not nil.
+func (i *introspection) token(ctx context.Context, raw string, newClaims func() jwt.Claims) (*jwt.Token, error) {
+	claims, err := i.claims(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	token := &jwt.Token{
+		Raw:    raw,
+		Header: map[string]any{},
+		Claims: claims,
+		Valid:  true,
+	}
+	if newClaims != nil {
+		data, err := json.Marshal(claims)
+		if err != nil {
+			return nil, err
+		}
+		typed := newClaims()
+		if err = json.Unmarshal(data, typed); err != nil {
+			return nil, fmt.Errorf("failed to decode introspection claims: %w", err)
+		}
+		token.Claims = typed
+	}
+	return token, nil
+}
+
+// claims of active raw token from cache or introspection endpoint, copied to be
+// safely modified by caller.
+func (i *introspection) claims(ctx context.Context, raw string) (jwt.MapClaims, error) {
+	sum := sha256.Sum256([]byte(raw))
+	key := hex.EncodeToString(sum[:])
+	now := i.now()
+
+	i.mu.Lock()
+	result, ok := i.cache[key]
+	i.mu.Unlock()
+	if !ok || !now.Before(result.expires) {
+		claims, err := i.introspect(ctx, raw)
+		if err == nil {
+			err = i.validate(claims, now)
+		}
+		if err != nil && !errors.Is(err, errTokenRejected) {
+			return nil, err
+		}
+		result = introspectionResult{claims: claims, err: err}
+		if err != nil {
+			result.expires = now.Add(i.cfg.NegativeCacheTTL)
+		} else {
+			result.expires = now.Add(i.cfg.MaxCacheTTL)
+			if exp, ok := claims["exp"].(float64); ok {
+				if t := time.Unix(int64(exp), 0).Add(i.cfg.ClockSkew); t.Before(result.expires) {
+					result.expires = t
+				}
+			}
+		}
+		i.store(key, result, now)
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+	claims := make(jwt.MapClaims, len(result.claims))
+	for k, v := range result.claims {
+		claims[k] = v
+	}
+	return claims, nil
+}
+
+func (i *introspection) store(key string, result introspectionResult, now time.Time) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(i.cache) >= maxIntrospectionCache {
+		for k, r := range i.cache {
+			if !now.Before(r.expires) {
+				delete(i.cache, k)
+			}
+		}
+		if len(i.cache) >= maxIntrospectionCache {
+			i.log.Warn("token introspection cache is full, dropping cached tokens",
+				zap.Int("size", len(i.cache)))
+			i.cache = make(map[string]introspectionResult)
+		}
+	}
+	i.cache[key] = result
+}
+
+// introspect raw token with introspection endpoint, returns claims of active
+// token or error wrapping errTokenRejected if token is inactive.
+func (i *introspection) introspect(ctx context.Context, raw string) (jwt.MapClaims, error) {
+	form := url.Values{
+		"token":           {raw},
+		"token_type_hint": {"access_token"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.cfg.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.cfg.ClientID != "" {
+		// client_secret_basic, credentials are form-urlencoded (RFC 6749, 2.3.1)
+		req.SetBasicAuth(url.QueryEscape(i.cfg.ClientID), url.QueryEscape(i.cfg.ClientSecret))
+	}
+	resp, err := i.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect token: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to introspect token: %s", resp.Status)
+	}
+	claims := jwt.MapClaims{}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode introspection response: %w", err)
+	}
+	if active, _ := claims["active"].(bool); !active {
+		return nil, fmt.Errorf("%w: token is not active", errTokenRejected)
+	}
+	i.log.Debug("token introspected",
+		zap.Any("sub", claims["sub"]))
+	return claims, nil
+}
+
+// validate claims of active token, errors wrap errTokenRejected.
+func (i *introspection) validate(claims jwt.MapClaims, now time.Time) error {
+	skew := i.cfg.ClockSkew
+	var reason string
+	switch {
+	case !claims.VerifyExpiresAt(now.Add(-skew).Unix(), false):
+		reason = "token is expired"
+	case !claims.VerifyNotBefore(now.Add(skew).Unix(), false):
+		reason = "token is not valid yet"
+	case i.cfg.Issuer != "" && !claims.VerifyIssuer(i.cfg.Issuer, true):
+		reason = "invalid issuer"
+	case i.cfg.Audience != "" && !claims.VerifyAudience(i.cfg.Audience, true):
+		reason = "invalid audience"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errTokenRejected, reason)
+}
@@ -0,0 +1,270 @@
+package grpcapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// introspectionEndpoint stands in for OAuth2 introspection endpoint responding
+// with responses by token and counting requests.
+type introspectionEndpoint struct {
+	*httptest.Server
+	calls atomic.Int32
+}
+
+func newIntrospectionEndpoint(t *testing.T, responses map[string]map[string]any) *introspectionEndpoint {
+	e := new(introspectionEndpoint)
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.calls.Add(1)
+		// client credentials are form-urlencoded
+		id, secret, _ := r.BasicAuth()
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		if id != "client" || secret != "s3cr%t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost || r.PostFormValue("token_type_hint") != "access_token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		token := r.PostFormValue("token")
+		if token == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp, ok := responses[token]
+		if !ok {
+			resp = map[string]any{"active": false}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(e.Close)
+	return e
+}
+
+func Test_introspection_claims(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	now := start
+	exp := float64(now.Add(time.Minute).Unix())
+	endpoint := newIntrospectionEndpoint(t, map[string]map[string]any{
+		"active":       {"active": true, "sub": "alice", "scope": "read", "exp": exp, "iss": "https://issuer", "aud": "api"},
+		"expired":      {"active": true, "sub": "alice", "exp": float64(now.Add(-time.Minute).Unix())},
+		"wrong issuer": {"active": true, "sub": "alice", "iss": "https://other", "aud": "api"},
+		"no audience":  {"active": true, "sub": "alice", "iss": "https://issuer"},
+	})
+	newTestIntrospection := func() *introspection {
+		i := newIntrospection(IntrospectionConfig{
+			URL:          endpoint.URL,
+			ClientID:     "client",
+			ClientSecret: "s3cr%t",
+			Issuer:       "https://issuer",
+			Audience:     "api",
+		})
+		i.now = func() time.Time {
+			return now
+		}
+		return i
+	}
+	tests := []struct {
+		name         string
+		token        string
+		wantSub      string
+		wantRejected bool
+	}{
+		{"active", "active", "alice", false},
+		{"inactive", "unknown", "", true},
+		{"expired", "expired", "", true},
+		{"wrong issuer", "wrong issuer", "", true},
+		{"no audience", "no audience", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := newTestIntrospection().claims(context.Background(), tt.token)
+			if errors.Is(err, errTokenRejected) != tt.wantRejected {
+				t.Fatalf("claims() error = %v, wantRejected %v", err, tt.wantRejected)
+			}
+			if err == nil && claims["sub"] != tt.wantSub {
+				t.Errorf("claims() sub = %v, want %v", claims["sub"], tt.wantSub)
+			}
+		})
+	}
+
+	t.Run("cache", func(t *testing.T) {
+		i := newTestIntrospection()
+		calls := func() int32 {
+			return endpoint.calls.Load()
+		}
+		start := calls()
+		for n := 0; n < 3; n++ {
+			if _, err := i.claims(context.Background(), "active"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := i.claims(context.Background(), "unknown"); !errors.Is(err, errTokenRejected) {
+				t.Fatal(err)
+			}
+		}
+		if got := calls() - start; got != 2 {
+			t.Errorf("cached introspection requests = %v, want 2", got)
+		}
+
+		// negative cache expires first
+		now = now.Add(11 * time.Second)
+		_, _ = i.claims(context.Background(), "active")
+		_, _ = i.claims(context.Background(), "unknown")
+		if got := calls() - start; got != 3 {
+			t.Errorf("introspection requests after negative cache ttl = %v, want 3", got)
+		}
+
+		// active token is cached until exp
+		now = now.Add(time.Minute)
+		if _, err := i.claims(context.Background(), "active"); !errors.Is(err, errTokenRejected) {
+			t.Errorf("claims() of expired token error = %v", err)
+		}
+		if got := calls() - start; got != 4 {
+			t.Errorf("introspection requests after exp = %v, want 4", got)
+		}
+	})
+
+	t.Run("failures are not cached", func(t *testing.T) {
+		now = start
+		i := newTestIntrospection()
+		start := endpoint.calls.Load()
+		for n := 0; n < 2; n++ {
+			if _, err := i.claims(context.Background(), "broken"); err == nil || errors.Is(err, errTokenRejected) {
+				t.Fatalf("claims() error = %v", err)
+			}
+		}
+		if got := endpoint.calls.Load() - start; got != 2 {
+			t.Errorf("introspection requests = %v, want 2", got)
+		}
+	})
+
+	t.Run("cached claims are copied", func(t *testing.T) {
+		now = start
+		i := newTestIntrospection()
+		claims, err := i.claims(context.Background(), "active")
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims["sub"] = "mallory"
+		if claims, _ = i.claims(context.Background(), "active"); claims["sub"] != "alice" {
+			t.Errorf("cached sub = %v", claims["sub"])
+		}
+	})
+}
+
+func Test_introspection_token(t *testing.T) {
+	endpoint := newIntrospectionEndpoint(t, map[string]map[string]any{
+		"active": {"active": true, "sub": "alice", "tenant": "acme"},
+	})
+	i := newIntrospection(IntrospectionConfig{URL: endpoint.URL, ClientID: "client", ClientSecret: "s3cr%t"})
+	token, err := i.token(context.Background(), "active", func() jwt.Claims {
+		return new(testClaims)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, ok := token.Claims.(*testClaims)
+	if !ok || claims.Subject != "alice" || claims.Tenant != "acme" {
+		t.Errorf("unexpected claims %#v", token.Claims)
+	}
+	mapped, err := mapClaims(token)
+	if err != nil || mapped["tenant"] != "acme" {
+		t.Errorf("mapClaims() = %v, %v", mapped, err)
+	}
+}
+
+func Test_app_tokenIntrospection(t *testing.T) {
+	endpoint := newIntrospectionEndpoint(t, map[string]map[string]any{
+		"opaque": {"active": true, "sub": "alice"},
+	})
+	a := New(
+		WithConfig(&Config{LogLevel: "info"}),
+		WithTokenIntrospection(IntrospectionConfig{
+			URL:          endpoint.URL,
+			ClientID:     "client",
+			ClientSecret: "s3cr%t",
+		}, "/grpcapp.test.Whoami/Internal"),
+		WithServiceImplementation(whoamiServiceDesc(), new(whoamiImplementation)),
+	)
+	go func() {
+		_ = a.Run(context.Background())
+	}()
+	<-a.Ready()
+	defer func() {
+		_ = a.Stop(context.Background())
+	}()
+	conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	tests := []struct {
+		name     string
+		method   string
+		token    string
+		want     string
+		wantCode codes.Code
+	}{
+		{"active", "Internal", "opaque", "introspection:alice", codes.OK},
+		{"active bearer", "Internal", "Bearer opaque", "introspection:alice", codes.OK},
+		{"inactive", "Internal", "unknown", "", codes.Unauthenticated},
+		{"not authenticated method", "Public", "", "", codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tt.token)
+			}
+			out := new(wrapperspb.StringValue)
+			err := conn.Invoke(ctx, "/grpcapp.test.Whoami/"+tt.method, new(emptypb.Empty), out)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %v, want %v", got, tt.wantCode)
+			}
+			if out.GetValue() != tt.want {
+				t.Errorf("principal = %v, want %v", out.GetValue(), tt.want)
+			}
+		})
+	}
+}
+
+func Test_introspection_checkConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{"valid", "https://auth.example.com/introspect", false},
+		{"empty", "", true},
+		{"relative", "/introspect", true},
+		{"malformed", "https://auth example.com/%", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := newIntrospection(IntrospectionConfig{URL: tt.url}).checkConfig(); (err != nil) != tt.wantErr {
+				t.Errorf("checkConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package grpcapp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+)
+
+// JwksConfig of WithJwksAuthentication option.
+type JwksConfig struct {
+
+	// URL of JSON Web Key Set, either URL or File is required.
+	URL string
+
+	// File with JSON Web Key Set.
+	File string
+
+	// RefreshInterval of cached keys (default 1h).
+	RefreshInterval time.Duration
+
+	// MinRefreshInterval between refetching keys for unknown key ids (default 1m).
+	MinRefreshInterval time.Duration
+
+	// Issuer expected in "iss" claim, not validated if empty.
+	Issuer string
+
+	// Audience expected in "aud" claim, not validated if empty.
+	Audience string
+
+	// ClockSkew tolerated when validating "exp", "nbf" and "iat" claims.
+	ClockSkew time.Duration
+
+	// HTTPClient to fetch keys with (http.DefaultClient if nil).
+	HTTPClient *http.Client
+}
+
+// WithJwksAuthentication enables JWT authentication for provided methods, verifying tokens
+// with keys from JSON Web Key Set selected by "kid" header. If not methods provided, the
+// authentication will be enabled for all requests.
+func WithJwksAuthentication(cfg JwksConfig, methods ...string) Option {
+	return &jwksAuthOption{cfg, methods}
+}
+
+type jwksAuthOption struct {
+	cfg     JwksConfig
+	methods []string
+}
+
+func (opt *jwksAuthOption) option(a *app) {
+	a.tools.jwt = newJwksData(opt.cfg)
+	a.tools.jwt.methods = opt.methods
+}
+
+// newJwksData verifying tokens with keys of JSON Web Key Set.
+func newJwksData(cfg JwksConfig) *jwtData {
+	keys := newJwks(cfg)
+	return &jwtData{
+		keyFunc: keys.keyFunc,
+		parser: &jwt.Parser{
+			ValidMethods: []string{
+				"RS256", "RS384", "RS512",
+				"PS256", "PS384", "PS512",
+				"ES256", "ES384", "ES512",
+				"EdDSA",
+			},
+			SkipClaimsValidation: true,
+		},
+		validate: keys.validate,
+		jwks:     keys,
+	}
+}
+
+// jwks caches keys of JSON Web Key Set.
+type jwks struct {
+	cfg JwksConfig
+	log *zap.Logger
+	now func() time.Time
+
+	mu      sync.Mutex
+	keys    map[string]jwk
+	fetched time.Time
+
+	// fetching is closed when the running fetch completes, nil if keys are
+	// not being fetched
+	fetching chan struct{}
+	fetchErr error
+}
+
+type jwk struct {
+	alg string
+	key any
+}
+
+func newJwks(cfg JwksConfig) *jwks {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = time.Hour
+	}
+	if cfg.MinRefreshInterval <= 0 {
+		cfg.MinRefreshInterval = time.Minute
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	return &jwks{
+		cfg: cfg,
+		log: zap.NewNop(),
+		now: time.Now,
+	}
+}
+
+func (k *jwks) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := k.key(kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.alg != "" && key.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("key %q is for %s algorithm, token is signed with %s", kid, key.alg, token.Method.Alg())
+	}
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("key %q is not RSA key", kid)
+		}
+	case *jwt.SigningMethodECDSA:
+		_, ok := key.key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("key %q is not EC key", kid)
+		}
+	case *jwt.SigningMethodEd25519:
+		_, ok := key.key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("key %q is not Ed25519 key", kid)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing method %s", token.Method.Alg())
+	}
+	return key.key, nil
+}
+
+// key by id, keys are refetched when expired or if id is unknown. Keys are
+// fetched once at a time without holding the lock, cached keys are served
+// while the fetch runs, callers of unknown ids wait for it. Token without id
+// may be verified with the only key of the set.
+func (k *jwks) key(kid string) (jwk, error) {
+	k.mu.Lock()
+	now := k.now()
+	key, found := k.lookup(kid)
+	refresh := k.fetched.IsZero() || now.Sub(k.fetched) >= k.cfg.RefreshInterval
+	if !refresh && !found {
+		// failed fetches are retried after MinRefreshInterval as well
+		refresh = now.Sub(k.fetched) >= k.cfg.MinRefreshInterval
+	}
+	if refresh && k.fetching == nil {
+		k.fetched = now
+		k.fetching = make(chan struct{})
+		go k.refresh(k.fetching)
+	}
+	fetching := k.fetching
+	k.mu.Unlock()
+	if found {
+		return key, nil
+	}
+
+	if fetching != nil {
+		<-fetching
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if key, found = k.lookup(kid); found {
+		return key, nil
+	}
+	if k.keys == nil && k.fetchErr != nil {
+		return jwk{}, k.fetchErr
+	}
+	return jwk{}, fmt.Errorf("key %q not found", kid)
+}
+
+// refresh keys, keeping cached keys if fetch fails, and close done.
+func (k *jwks) refresh(done chan struct{}) {
+	keys, err := k.fetch()
+	k.mu.Lock()
+	if err != nil {
+		if k.keys != nil {
+			k.log.Error("failed to refresh jwks, using cached keys",
+				zap.Error(err))
+		}
+	} else {
+		k.keys = keys
+		k.log.Debug("refreshed jwks",
+			zap.Int("keys", len(keys)))
+	}
+	k.fetchErr = err
+	k.fetching = nil
+	k.mu.Unlock()
+	close(done)
+}
+
+func (k *jwks) lookup(kid string) (jwk, bool) {
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// checkConfig fails on JwksConfig without key set source or with malformed URL.
+func (k *jwks) checkConfig() error {
+	switch {
+	case k.cfg.URL != "":
+		return checkHTTPURL(k.cfg.URL)
+	case k.cfg.File != "":
+		return nil
+	default:
+		return errors.New("jwks url or file is required")
+	}
+}
+
+// checkHTTPURL fails if raw is not an absolute http(s) URL.
+func checkHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q: absolute http or https url is required", raw)
+	}
+	return nil
+}
+
+func (k *jwks) fetch() (map[string]jwk, error) {
+	var data []byte
+	var err error
+	switch {
+	case k.cfg.URL != "":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		data, err = k.download(ctx)
+	case k.cfg.File != "":
+		data, err = os.ReadFile(k.cfg.File)
+	default:
+		err = errors.New("jwks url or file is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseJwks(data, k.log)
+}
+
+func (k *jwks) download(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.cfg.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := k.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks request failed with status %d", res.StatusCode)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// validate registered claims of token parsed without claims validation.
+func (k *jwks) validate(token *jwt.Token) error {
+	claims, err := mapClaims(token)
+	if err != nil {
+		return err
+	}
+	now := k.now()
+	skew := k.cfg.ClockSkew
+	if !claims.VerifyExpiresAt(now.Add(-skew).Unix(), false) {
+		return errors.New("token is expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(skew).Unix(), false) {
+		return errors.New("token is not valid yet")
+	}
+	if !claims.VerifyIssuedAt(now.Add(skew).Unix(), false) {
+		return errors.New("token used before issued")
+	}
+	if k.cfg.Issuer != "" && !claims.VerifyIssuer(k.cfg.Issuer, true) {
+		return errors.New("invalid issuer")
+	}
+	if k.cfg.Audience != "" && !claims.VerifyAudience(k.cfg.Audience, true) {
+		return errors.New("invalid audience")
+	}
+	return nil
+}
+
+// parseJwks parses RSA, EC and Ed25519 signature keys of JSON Web Key Set,
+// other keys are skipped, as well as invalid or unsupported keys, which are
+// logged. Key set without usable keys is an error.
+func parseJwks(data []byte, log *zap.Logger) (map[string]jwk, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse jwks: %w", err)
+	}
+	keys := make(map[string]jwk, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key any
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = parseRSAKey(k.N, k.E)
+		case "EC":
+			key, err = parseECKey(k.Crv, k.X, k.Y)
+		case "OKP":
+			key, err = parseOKPKey(k.Crv, k.X)
+		default:
+			continue
+		}
+		if err != nil {
+			log.Warn("skipped jwk",
+				zap.String("kid", k.Kid),
+				zap.Error(err))
+			continue
+		}
+		keys[k.Kid] = jwk{alg: k.Alg, key: key}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no usable keys in jwks")
+	}
+	return keys, nil
+}
+
+func parseRSAKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+	exp := new(big.Int).SetBytes(eb)
+	if !exp.IsInt64() || exp.Int64() > 1<<31-1 || len(nb) == 0 {
+		return nil, errors.New("invalid rsa key")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(exp.Int64())}, nil
+}
+
+func parseECKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, err
+	}
+	yb, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, err
+	}
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("point is not on curve")
+	}
+	return key, nil
+}
+
+func parseOKPKey(crv, x string) (ed25519.PublicKey, error) {
+	if crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, err
+	}
+	if len(xb) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 key size")
+	}
+	return ed25519.PublicKey(xb), nil
+}
@@ -0,0 +1,453 @@
+package grpcapp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var (
+	testRSAKeyOnce sync.Once
+	testRSAKey     *rsa.PrivateKey
+)
+
+// newTestRSAKey returns RSA key shared by tests, generating it is slow.
+func newTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	testRSAKeyOnce.Do(func() {
+		var err error
+		if testRSAKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return testRSAKey
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// testJwk returns JSON Web Key of public part of key.
+func testJwk(kid string, key any) map[string]string {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return map[string]string{"kty": "RSA", "kid": kid, "n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())}
+	case *ecdsa.PrivateKey:
+		return map[string]string{"kty": "EC", "kid": kid, "crv": k.Curve.Params().Name, "x": b64(k.X.Bytes()), "y": b64(k.Y.Bytes())}
+	case ed25519.PrivateKey:
+		return map[string]string{"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": b64(k.Public().(ed25519.PublicKey))}
+	}
+	panic("unsupported key")
+}
+
+func testJwks(t *testing.T, keys ...map[string]string) []byte {
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func Test_parseJwks(t *testing.T) {
+	rsaKey := newTestRSAKey(t)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	enc := testJwk("enc", rsaKey)
+	enc["use"] = "enc"
+	badCurve := testJwk("ec", ecKey)
+	badCurve["crv"] = "P-0"
+	x25519 := map[string]string{"kty": "OKP", "kid": "x25519", "crv": "X25519", "x": b64(make([]byte, 32))}
+	tests := []struct {
+		name     string
+		data     []byte
+		wantKids []string
+		wantErr  bool
+	}{
+		{"keys", testJwks(t, testJwk("rsa", rsaKey), testJwk("ec", ecKey), testJwk("ed", edKey)), []string{"rsa", "ec", "ed"}, false},
+		{"skip encryption and symmetric keys", testJwks(t, testJwk("rsa", rsaKey), enc, map[string]string{"kty": "oct", "kid": "oct", "k": "c2VjcmV0"}), []string{"rsa"}, false},
+		{"skip invalid and unsupported keys", testJwks(t, testJwk("rsa", rsaKey), badCurve, x25519), []string{"rsa"}, false},
+		{"invalid json", []byte("{"), nil, true},
+		{"no usable keys", testJwks(t, enc, badCurve, x25519), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseJwks(tt.data, zap.NewNop())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJwks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.wantKids) {
+				t.Errorf("expected %d keys, got %d", len(tt.wantKids), len(got))
+			}
+			for _, kid := range tt.wantKids {
+				if _, ok := got[kid]; !ok {
+					t.Errorf("key %s not found", kid)
+				}
+			}
+		})
+	}
+}
+
+func Test_jwks_keyFunc(t *testing.T) {
+	rsaKey := newTestRSAKey(t)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	withAlg := testJwk("alg", ecKey)
+	withAlg["alg"] = "ES384"
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	writeTestFile(t, file, testJwks(t, testJwk("rsa", rsaKey), testJwk("ec", ecKey), testJwk("ed", edKey), withAlg))
+	keys := newJwks(JwksConfig{File: file})
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"rsa", signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, jwt.MapClaims{}), false},
+		{"rsa pss", signTestToken(t, jwt.SigningMethodPS256, "rsa", rsaKey, jwt.MapClaims{}), false},
+		{"ec", signTestToken(t, jwt.SigningMethodES256, "ec", ecKey, jwt.MapClaims{}), false},
+		{"ed25519", signTestToken(t, jwt.SigningMethodEdDSA, "ed", edKey, jwt.MapClaims{}), false},
+		{"key type mismatch", signTestToken(t, jwt.SigningMethodES256, "rsa", ecKey, jwt.MapClaims{}), true},
+		{"key alg mismatch", signTestToken(t, jwt.SigningMethodES256, "alg", ecKey, jwt.MapClaims{}), true},
+		{"unknown kid", signTestToken(t, jwt.SigningMethodRS256, "unknown", rsaKey, jwt.MapClaims{}), true},
+		{"without kid", signTestToken(t, jwt.SigningMethodRS256, "", rsaKey, jwt.MapClaims{}), true},
+		{"hmac", signTestToken(t, jwt.SigningMethodHS256, "rsa", []byte("secret"), jwt.MapClaims{}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parser.Parse(tt.token, keys.keyFunc); (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_jwks_key(t *testing.T) {
+	rsaKey := newTestRSAKey(t)
+	var requests int32
+	var data atomic.Value
+	data.Store(testJwks(t, testJwk("first", rsaKey)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write(data.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	keys := newJwks(JwksConfig{URL: srv.URL, RefreshInterval: time.Hour, MinRefreshInterval: time.Minute})
+	keys.now = func() time.Time {
+		return now
+	}
+	steps := []struct {
+		name         string
+		advance      time.Duration
+		kid          string
+		wantErr      bool
+		wantRequests int32
+	}{
+		{"initial fetch", 0, "first", false, 1},
+		{"cached", time.Second, "first", false, 1},
+		{"without kid uses the only key", 0, "", false, 1},
+		{"unknown kid refetch limited", 0, "second", true, 1},
+		{"unknown kid refetched", time.Minute, "second", false, 2},
+		{"refreshed after interval", time.Hour, "first", true, 3},
+	}
+	for i, step := range steps {
+		if i == 3 {
+			data.Store(testJwks(t, testJwk("second", rsaKey)))
+		}
+		now = now.Add(step.advance)
+		_, err := keys.key(step.kid)
+		if (err != nil) != step.wantErr {
+			t.Errorf("%s: key() error = %v, wantErr %v", step.name, err, step.wantErr)
+		}
+		if got := atomic.LoadInt32(&requests); got != step.wantRequests {
+			t.Errorf("%s: expected %d requests, got %d", step.name, step.wantRequests, got)
+		}
+	}
+
+	// cached keys are used if refresh fails
+	srv.Config.Handler = http.NotFoundHandler()
+	now = now.Add(time.Hour)
+	if _, err := keys.key("second"); err != nil {
+		t.Errorf("expected cached key, got %v", err)
+	}
+}
+
+func Test_jwks_validate(t *testing.T) {
+	now := time.Now()
+	keys := newJwks(JwksConfig{Issuer: "issuer", Audience: "audience", ClockSkew: time.Minute})
+	keys.now = func() time.Time {
+		return now
+	}
+	// claims are compared as numbers decoded from json
+	unix := func(t time.Time) float64 {
+		return float64(t.Unix())
+	}
+	valid := func(claims jwt.MapClaims) jwt.MapClaims {
+		claims["iss"] = "issuer"
+		if _, ok := claims["aud"]; !ok {
+			claims["aud"] = "audience"
+		}
+		return claims
+	}
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		wantErr bool
+	}{
+		{"valid", valid(jwt.MapClaims{"exp": unix(now.Add(time.Minute))}), false},
+		{"audience list", valid(jwt.MapClaims{"aud": []any{"other", "audience"}}), false},
+		{"expired within skew", valid(jwt.MapClaims{"exp": unix(now.Add(-30 * time.Second))}), false},
+		{"expired", valid(jwt.MapClaims{"exp": unix(now.Add(-2 * time.Minute))}), true},
+		{"not before within skew", valid(jwt.MapClaims{"nbf": unix(now.Add(30 * time.Second))}), false},
+		{"not before", valid(jwt.MapClaims{"nbf": unix(now.Add(2 * time.Minute))}), true},
+		{"issued in future", valid(jwt.MapClaims{"iat": unix(now.Add(2 * time.Minute))}), true},
+		{"invalid issuer", jwt.MapClaims{"iss": "other", "aud": "audience"}, true},
+		{"missing issuer", jwt.MapClaims{"aud": "audience"}, true},
+		{"invalid audience", valid(jwt.MapClaims{"aud": "other"}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := keys.validate(&jwt.Token{Claims: tt.claims}); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_app_jwksAuthentication(t *testing.T) {
+	rsaKey := newTestRSAKey(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testJwks(t, testJwk("key", rsaKey)))
+	}))
+	defer srv.Close()
+
+	a := New(
+		WithConfig(&Config{LogLevel: "info"}),
+		WithJwksAuthentication(JwksConfig{URL: srv.URL, Issuer: "issuer", Audience: "audience"}, "/grpcapp.test.Whoami/Internal"),
+		WithServiceImplementation(whoamiServiceDesc(), new(whoamiImplementation)),
+	)
+	go func() {
+		_ = a.Run(context.Background())
+	}()
+	<-a.Ready()
+	defer func() {
+		_ = a.Stop(context.Background())
+	}()
+	conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	claims := func(aud string) jwt.MapClaims {
+		return jwt.MapClaims{"iss": "issuer", "aud": aud, "exp": time.Now().Add(time.Minute).Unix()}
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  codes.Code
+	}{
+		{"valid", signTestToken(t, jwt.SigningMethodRS256, "key", rsaKey, claims("audience")), codes.OK},
+		{"valid bearer", "Bearer " + signTestToken(t, jwt.SigningMethodRS256, "key", rsaKey, claims("audience")), codes.OK},
+		{"invalid audience", signTestToken(t, jwt.SigningMethodRS256, "key", rsaKey, claims("other")), codes.Unauthenticated},
+		{"unknown kid", signTestToken(t, jwt.SigningMethodRS256, "other", rsaKey, claims("audience")), codes.Unauthenticated},
+		{"without token", "", codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tt.token)
+			}
+			err := conn.Invoke(ctx, "/grpcapp.test.Whoami/Internal", new(emptypb.Empty), new(wrapperspb.StringValue))
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("Internal() code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithJwksAuthentication(t *testing.T) {
+	a := &app{tools: &tools{}}
+	WithJwksAuthentication(JwksConfig{File: os.DevNull}, "/pkg.Svc/Method").option(a)
+	if a.tools.jwt == nil || a.tools.jwt.jwks == nil || a.tools.jwt.keyFunc == nil {
+		t.Fatal("expected jwks authentication to be configured")
+	}
+	if a.tools.jwt.jwks.cfg.RefreshInterval != time.Hour || a.tools.jwt.jwks.cfg.MinRefreshInterval != time.Minute {
+		t.Errorf("unexpected default refresh intervals %+v", a.tools.jwt.jwks.cfg)
+	}
+}
+
+func Test_app_initAuthn(t *testing.T) {
+	tests := []struct {
+		name    string
+		option  Option
+		wantErr bool
+	}{
+		{"jwks file", WithJwksAuthentication(JwksConfig{File: os.DevNull}), false},
+		{"jwks url", WithJwksAuthentication(JwksConfig{URL: "https://example.com/jwks.json"}), false},
+		{"jwks without source", WithJwksAuthentication(JwksConfig{}), true},
+		{"jwks relative url", WithJwksAuthentication(JwksConfig{URL: "jwks.json"}), true},
+		{"chained jwks authenticator", WithAuthenticator(ChainAuthenticators(
+			BasicAuthenticator(),
+			JwksAuthenticator(JwksConfig{URL: "ftp://example.com/jwks.json"}),
+		)), true},
+		{"introspection without url", WithTokenIntrospection(IntrospectionConfig{}), true},
+		{"introspection authenticator", WithAuthenticator(IntrospectionAuthenticator(IntrospectionConfig{URL: "introspect"})), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(tt.option).(*app)
+			err := a.initAuthn()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("initAuthn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var appErr *Error
+			if err != nil && (!errors.As(err, &appErr) || appErr.Phase != PhaseConfig) {
+				t.Errorf("initAuthn() error = %v, want config phase error", err)
+			}
+		})
+	}
+}
+
+func Test_jwks_keyFetchFailing(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	keys := newJwks(JwksConfig{URL: srv.URL, RefreshInterval: time.Hour, MinRefreshInterval: time.Minute})
+	keys.now = func() time.Time {
+		return now
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := keys.key("first"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("expected 1 request, got %d", got)
+	}
+	now = now.Add(time.Minute)
+	if _, err := keys.key("first"); err == nil {
+		t.Fatal("expected error")
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("expected fetch retried after min refresh interval, got %d requests", got)
+	}
+}
+
+func Test_jwks_keyRefreshing(t *testing.T) {
+	rsaKey := newTestRSAKey(t)
+	var requests int32
+	fetched := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			// refresh blocks until released
+			fetched <- struct{}{}
+			<-release
+			_, _ = w.Write(testJwks(t, testJwk("first", rsaKey), testJwk("second", rsaKey)))
+			return
+		}
+		_, _ = w.Write(testJwks(t, testJwk("first", rsaKey)))
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	var nowMu sync.Mutex
+	keys := newJwks(JwksConfig{URL: srv.URL, RefreshInterval: time.Hour, MinRefreshInterval: time.Minute})
+	keys.now = func() time.Time {
+		nowMu.Lock()
+		defer nowMu.Unlock()
+		return now
+	}
+	if _, err := keys.key("first"); err != nil {
+		t.Fatal(err)
+	}
+	nowMu.Lock()
+	now = now.Add(time.Minute)
+	nowMu.Unlock()
+
+	// unknown kids wait for a single refresh
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := keys.key("second")
+			errs <- err
+		}()
+	}
+	<-fetched
+
+	// cached keys are served while refreshing
+	done := make(chan error, 1)
+	go func() {
+		_, err := keys.key("first")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected cached key, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("cached key is blocked by refresh")
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("expected refreshed key, got %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("expected 2 requests, got %d", got)
+	}
+}
@@ -0,0 +1,122 @@
+package grpcapp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+)
+
+// initJwtConfig enables JWT authentication configured with JwtAlgorithm and key
+// from environment unless JWT authentication is enabled with an option, whose
+// method patterns are validated then.
+func (a *app) initJwtConfig() error {
+	cfg := a.tools.cfg
+	if a.tools.jwt != nil {
+		if err := checkPatterns(a.tools.jwt.methods); err != nil {
+			return newError(PhaseConfig, "invalid jwt authentication methods", err)
+		}
+		if cfg.JwtAlgorithm != "" {
+			a.tools.log.Warn("jwt authentication is enabled with option, jwt config is ignored")
+		}
+		return nil
+	}
+	if cfg.JwtAlgorithm == "" {
+		return nil
+	}
+	data, err := newJwtConfigData(cfg)
+	if err != nil {
+		return newError(PhaseConfig, "invalid jwt config", err)
+	}
+	a.tools.jwt = data
+	a.tools.log.Info("loaded jwt config",
+		zap.String("algorithm", cfg.JwtAlgorithm),
+		zap.Strings("methods", cfg.JwtMethods))
+	return nil
+}
+
+// newJwtConfigData verifying tokens signed with JwtAlgorithm only.
+func newJwtConfigData(cfg *Config) (*jwtData, error) {
+	method := jwt.GetSigningMethod(cfg.JwtAlgorithm)
+	if method == nil || method.Alg() == "none" {
+		return nil, fmt.Errorf("unsupported algorithm %q", cfg.JwtAlgorithm)
+	}
+	if err := checkPatterns(cfg.JwtMethods); err != nil {
+		return nil, fmt.Errorf("invalid methods: %w", err)
+	}
+	key, err := loadJwtKey(method, cfg.JwtKeyFile, cfg.JwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	alg := method.Alg()
+	return &jwtData{
+		keyFunc: func(token *jwt.Token) (any, error) {
+			if token.Method.Alg() != alg {
+				return nil, fmt.Errorf("unexpected signing algorithm %s", token.Method.Alg())
+			}
+			return key, nil
+		},
+		methods: cfg.JwtMethods,
+		parser:  &jwt.Parser{ValidMethods: []string{alg}},
+		validate: func(token *jwt.Token) error {
+			claims, err := mapClaims(token)
+			if err != nil {
+				return err
+			}
+			if cfg.JwtIssuer != "" && !claims.VerifyIssuer(cfg.JwtIssuer, true) {
+				return errors.New("invalid issuer")
+			}
+			if cfg.JwtAudience != "" && !claims.VerifyAudience(cfg.JwtAudience, true) {
+				return errors.New("invalid audience")
+			}
+			return nil
+		},
+	}, nil
+}
+
+// loadJwtKey verifying signatures of method, HMAC secret from secret or keyFile,
+// PEM encoded public key (or certificate) from keyFile otherwise.
+func loadJwtKey(method jwt.SigningMethod, keyFile, secret string) (any, error) {
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		if secret != "" {
+			return []byte(secret), nil
+		}
+		if keyFile == "" {
+			return nil, fmt.Errorf("%s requires secret or key file", method.Alg())
+		}
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		data = []byte(strings.TrimRight(string(data), "\r\n"))
+		if len(data) == 0 {
+			return nil, fmt.Errorf("key file %s is empty", keyFile)
+		}
+		return data, nil
+	}
+	if keyFile == "" {
+		return nil, fmt.Errorf("%s requires public key file", method.Alg())
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	var key any
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		key, err = jwt.ParseRSAPublicKeyFromPEM(data)
+	case *jwt.SigningMethodECDSA:
+		key, err = jwt.ParseECPublicKeyFromPEM(data)
+	case *jwt.SigningMethodEd25519:
+		key, err = jwt.ParseEdPublicKeyFromPEM(data)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", method.Alg())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s public key %s: %w", method.Alg(), keyFile, err)
+	}
+	return key, nil
+}
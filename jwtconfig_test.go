@@ -0,0 +1,231 @@
+package grpcapp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// writeTestPublicKey writes PEM encoded public key of private key to a temporary file.
+func writeTestPublicKey(t *testing.T, key any) string {
+	pub, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "public.pem")
+	writeTestFile(t, name, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+	return name
+}
+
+func Test_newJwtConfigData(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaFile := writeTestPublicKey(t, &rsaKey.PublicKey)
+	ecFile := writeTestPublicKey(t, &ecKey.PublicKey)
+	edFile := writeTestPublicKey(t, edPub)
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	writeTestFile(t, secretFile, []byte("file-secret\n"))
+	badFile := filepath.Join(t.TempDir(), "bad.pem")
+	writeTestFile(t, badFile, []byte("bad"))
+
+	sign := func(method jwt.SigningMethod, key any, claims jwt.MapClaims) string {
+		signed, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	claims := jwt.MapClaims{"sub": "alice", "iss": "https://issuer", "aud": "api"}
+	rsaPEM, err := os.ReadFile(rsaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type check struct {
+		token string
+		valid bool
+	}
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantErr bool
+		checks  []check
+	}{
+		{"hs256 secret", &Config{JwtAlgorithm: "HS256", JwtSecret: "secret"}, false, []check{
+			{sign(jwt.SigningMethodHS256, []byte("secret"), claims), true},
+			{sign(jwt.SigningMethodHS384, []byte("secret"), claims), false},
+			{sign(jwt.SigningMethodHS256, []byte("other"), claims), false},
+		}},
+		{"hs256 key file", &Config{JwtAlgorithm: "HS256", JwtKeyFile: secretFile}, false, []check{
+			{sign(jwt.SigningMethodHS256, []byte("file-secret"), claims), true},
+		}},
+		{"rs256", &Config{JwtAlgorithm: "RS256", JwtKeyFile: rsaFile}, false, []check{
+			{sign(jwt.SigningMethodRS256, rsaKey, claims), true},
+			{sign(jwt.SigningMethodPS256, rsaKey, claims), false},
+			// public key used as HMAC secret
+			{sign(jwt.SigningMethodHS256, rsaPEM, claims), false},
+		}},
+		{"es256", &Config{JwtAlgorithm: "ES256", JwtKeyFile: ecFile}, false, []check{
+			{sign(jwt.SigningMethodES256, ecKey, claims), true},
+		}},
+		{"eddsa", &Config{JwtAlgorithm: "EdDSA", JwtKeyFile: edFile}, false, []check{
+			{sign(jwt.SigningMethodEdDSA, edKey, claims), true},
+			{sign(jwt.SigningMethodRS256, rsaKey, claims), false},
+		}},
+		{"issuer and audience", &Config{JwtAlgorithm: "HS256", JwtSecret: "secret", JwtIssuer: "https://issuer", JwtAudience: "api"}, false, []check{
+			{sign(jwt.SigningMethodHS256, []byte("secret"), claims), true},
+			{sign(jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{"iss": "https://other", "aud": "api"}), false},
+			{sign(jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{"iss": "https://issuer"}), false},
+		}},
+		{"unknown algorithm", &Config{JwtAlgorithm: "XX256", JwtSecret: "secret"}, true, nil},
+		{"none algorithm", &Config{JwtAlgorithm: "none", JwtSecret: "secret"}, true, nil},
+		{"missing secret", &Config{JwtAlgorithm: "HS256"}, true, nil},
+		{"missing key file", &Config{JwtAlgorithm: "RS256", JwtSecret: "secret"}, true, nil},
+		{"not found key file", &Config{JwtAlgorithm: "RS256", JwtKeyFile: filepath.Join(t.TempDir(), "missing.pem")}, true, nil},
+		{"bad key file", &Config{JwtAlgorithm: "ES256", JwtKeyFile: badFile}, true, nil},
+		{"key of other algorithm", &Config{JwtAlgorithm: "ES256", JwtKeyFile: rsaFile}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := newJwtConfigData(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newJwtConfigData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for i, c := range tt.checks {
+				_, err := data.parse(context.Background(), c.token, nil)
+				if (err == nil) != c.valid {
+					t.Errorf("check %d parse() error = %v, valid %v", i, err, c.valid)
+				}
+			}
+		})
+	}
+}
+
+func Test_app_initJwtConfig(t *testing.T) {
+	keyFunc := func(*jwt.Token) (any, error) {
+		return nil, errors.New("unused")
+	}
+	tests := []struct {
+		name    string
+		cfg     *Config
+		jwt     *jwtData
+		wantJwt bool
+		wantErr bool
+	}{
+		{"not configured", &Config{}, nil, false, false},
+		{"configured", &Config{JwtAlgorithm: "HS256", JwtSecret: "secret"}, nil, true, false},
+		{"option takes precedence", &Config{JwtAlgorithm: "HS256"}, &jwtData{keyFunc: keyFunc}, true, false},
+		{"invalid", &Config{JwtAlgorithm: "HS256"}, nil, false, true},
+		{"invalid methods", &Config{JwtAlgorithm: "HS256", JwtSecret: "secret", JwtMethods: []string{"/pkg.Greeter/["}}, nil, false, true},
+		{"invalid option methods", &Config{}, &jwtData{keyFunc: keyFunc, methods: []string{"/pkg.Greeter/["}}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &app{tools: &tools{cfg: tt.cfg, log: zap.NewNop(), jwt: tt.jwt}}
+			err := a.initJwtConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("initJwtConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var appErr *Error
+			if err != nil && (!errors.As(err, &appErr) || appErr.Phase != PhaseConfig) {
+				t.Errorf("initJwtConfig() error phase = %v", err)
+			}
+			if (a.tools.jwt != nil) != tt.wantJwt {
+				t.Errorf("initJwtConfig() jwt = %v, want %v", a.tools.jwt, tt.wantJwt)
+			}
+			if tt.jwt != nil && a.tools.jwt != tt.jwt {
+				t.Error("initJwtConfig() replaced jwt option")
+			}
+		})
+	}
+}
+
+func Test_app_jwtConfig(t *testing.T) {
+	a := New(
+		WithConfig(&Config{
+			LogLevel:     "info",
+			JwtAlgorithm: "HS256",
+			JwtSecret:    "secret",
+			JwtMethods:   []string{"/grpcapp.test.Whoami/Int*"},
+		}),
+		WithServiceImplementation(whoamiServiceDesc(), new(whoamiImplementation)),
+	)
+	go func() {
+		_ = a.Run(context.Background())
+	}()
+	<-a.Ready()
+	defer func() {
+		_ = a.Stop(context.Background())
+	}()
+	conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	sign := func(method jwt.SigningMethod) string {
+		signed, err := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "alice"}).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	tests := []struct {
+		name     string
+		method   string
+		token    string
+		want     string
+		wantCode codes.Code
+	}{
+		{"valid", "Internal", sign(jwt.SigningMethodHS256), "jwt:alice", codes.OK},
+		{"algorithm mismatch", "Internal", sign(jwt.SigningMethodHS512), "", codes.Unauthenticated},
+		{"no token", "Internal", "", "", codes.Unauthenticated},
+		{"not protected", "Public", "", "", codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tt.token)
+			}
+			out := new(wrapperspb.StringValue)
+			err := conn.Invoke(ctx, "/grpcapp.test.Whoami/"+tt.method, new(emptypb.Empty), out)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %v, want %v", got, tt.wantCode)
+			}
+			if out.GetValue() != tt.want {
+				t.Errorf("principal = %v, want %v", out.GetValue(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package grpcapp
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// metrics of the application, exposed on admin server.
+type metrics struct {
+	registry *prometheus.Registry
+	handled  *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+	panics   *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Total number of RPCs completed on the server.",
+		}, []string{"service", "method", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Latency of RPCs handled by the server.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"service", "method", "code"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_server_in_flight",
+			Help: "Number of RPCs currently handled by the server.",
+		}, []string{"service", "method"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_panics_total",
+			Help: "Total number of panics recovered in RPCs handled by the server.",
+		}, []string{"service", "method"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.handled,
+		m.latency,
+		m.inFlight,
+		m.panics,
+	)
+	return m
+}
+
+// observe starts measuring a call and returns a function to be called once it's done.
+func (m *metrics) observe(fullMethod string) func(error) {
+	service, method := splitMethod(fullMethod)
+	inFlight := m.inFlight.WithLabelValues(service, method)
+	inFlight.Inc()
+	start := time.Now()
+	return func(err error) {
+		inFlight.Dec()
+		code := status.Code(err).String()
+		m.handled.WithLabelValues(service, method, code).Inc()
+		m.latency.WithLabelValues(service, method, code).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (m *metrics) unaryInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	done := m.observe(info.FullMethod)
+	res, err := handler(ctx, req)
+	done(err)
+	return res, err
+}
+
+func (m *metrics) streamInterceptor(
+	srv any,
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	done := m.observe(info.FullMethod)
+	err := handler(srv, stream)
+	done(err)
+	return err
+}
+
+// splitMethod splits "/pkg.Service/Method" into service and method names.
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
+
+// dbCollector exports pgxpool.Stat as prometheus metrics.
+type dbCollector struct {
+	pool *pgxpool.Pool
+
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	acquiredConns        *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	idleConns            *prometheus.Desc
+	maxConns             *prometheus.Desc
+	totalConns           *prometheus.Desc
+}
+
+func newDBCollector(pool *pgxpool.Pool) *dbCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("db_pool_"+name, help, nil, nil)
+	}
+	return &dbCollector{
+		pool:                 pool,
+		acquireCount:         desc("acquire_count_total", "Cumulative count of successful acquires from the pool."),
+		acquireDuration:      desc("acquire_duration_seconds_total", "Total duration of all successful acquires from the pool."),
+		acquiredConns:        desc("acquired_conns", "Number of currently acquired connections in the pool."),
+		canceledAcquireCount: desc("canceled_acquire_count_total", "Cumulative count of acquires from the pool that were canceled by a context."),
+		constructingConns:    desc("constructing_conns", "Number of conns with construction in progress in the pool."),
+		emptyAcquireCount:    desc("empty_acquire_count_total", "Cumulative count of successful acquires that waited for a connection."),
+		idleConns:            desc("idle_conns", "Number of currently idle conns in the pool."),
+		maxConns:             desc("max_conns", "Maximum size of the pool."),
+		totalConns:           desc("total_conns", "Total number of resources currently in the pool."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *dbCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.acquiredConns
+	ch <- c.canceledAcquireCount
+	ch <- c.constructingConns
+	ch <- c.emptyAcquireCount
+	ch <- c.idleConns
+	ch <- c.maxConns
+	ch <- c.totalConns
+}
+
+// Collect implements prometheus.Collector.
+func (c *dbCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, s.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquireCount, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.constructingConns, prometheus.GaugeValue, float64(s.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquireCount, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(s.TotalConns()))
+}
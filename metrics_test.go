@@ -0,0 +1,67 @@
+package grpcapp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_splitMethod(t *testing.T) {
+	tests := []struct {
+		fullMethod  string
+		wantService string
+		wantMethod  string
+	}{
+		{"/pkg.Service/Method", "pkg.Service", "Method"},
+		{"Method", "unknown", "Method"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fullMethod, func(t *testing.T) {
+			service, method := splitMethod(tt.fullMethod)
+			if service != tt.wantService || method != tt.wantMethod {
+				t.Errorf("splitMethod() = %v, %v, want %v, %v", service, method, tt.wantService, tt.wantMethod)
+			}
+		})
+	}
+}
+
+func Test_metrics_unaryInterceptor(t *testing.T) {
+	m := newMetrics()
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Method"}
+	_, _ = m.unaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		if got := testutil.ToFloat64(m.inFlight.WithLabelValues("pkg.Service", "Method")); got != 1 {
+			t.Errorf("expected 1 call in flight, got %v", got)
+		}
+		return nil, nil
+	})
+	_, _ = m.unaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	if got := testutil.ToFloat64(m.inFlight.WithLabelValues("pkg.Service", "Method")); got != 0 {
+		t.Errorf("expected no calls in flight, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.handled.WithLabelValues("pkg.Service", "Method", "OK")); got != 1 {
+		t.Errorf("expected 1 OK call, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.handled.WithLabelValues("pkg.Service", "Method", "NotFound")); got != 1 {
+		t.Errorf("expected 1 NotFound call, got %v", got)
+	}
+	if got := testutil.CollectAndCount(m.latency); got != 2 {
+		t.Errorf("expected 2 latency series, got %v", got)
+	}
+}
+
+func Test_metrics_streamInterceptor(t *testing.T) {
+	m := newMetrics()
+	info := &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Stream"}
+	_ = m.streamInterceptor(nil, nil, info, func(srv any, stream grpc.ServerStream) error {
+		return nil
+	})
+	if got := testutil.ToFloat64(m.handled.WithLabelValues("pkg.Service", "Stream", "OK")); got != 1 {
+		t.Errorf("expected 1 OK call, got %v", got)
+	}
+}
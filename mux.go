@@ -0,0 +1,101 @@
+package grpcapp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/soheilhy/cmux"
+	"go.uber.org/zap"
+)
+
+// listenSingle opens a single listener on GrpcListenPort and multiplexes it
+// between grpc, http and admin servers. AdminListenAddr is not listened on.
+// Connections are dispatched by their first request: TLS goes to http server
+// (grpc server without WithHTTP option), plaintext HTTP/2 "application/grpc"
+// content-type to grpc server if TLS is not configured and HTTP/1 admin paths
+// to admin server. In h2c mode http server serves everything but admin paths,
+// native grpc included.
+func (a *app) listenSingle() error {
+	if a.serveHttp && !a.httpH2C() {
+		if err := a.checkHttpTLS(); err != nil {
+			return err
+		}
+	}
+	addr := fmt.Sprintf(":%d", a.tools.cfg.GrpcListenPort)
+	a.tools.log.Info("starting single port server",
+		zap.String("address", addr),
+		zap.Bool("http", a.serveHttp),
+		zap.Bool("h2c", a.serveHttp && a.httpH2C()),
+		zap.Bool("admin", a.adminServer != nil))
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return newError(PhaseListen, "failed to listen on "+addr, err)
+	}
+
+	// matchers are tried in order of registration, connections are dispatched
+	// by their first request
+	m := cmux.New(lis)
+	var grpcLis, httpLis, adminLis net.Listener
+	if a.serveHttp && a.httpH2C() {
+		// settings sent while matching would break h2c connections falling
+		// through to http server, so it serves native grpc as well
+		if a.adminServer != nil {
+			adminLis = m.Match(a.matchAdmin)
+		}
+		httpLis = m.Match(cmux.Any())
+	} else {
+		switch {
+		case a.tls == nil:
+			// grpc clients wait for server settings before sending headers
+			grpcLis = m.MatchWithWriters(
+				cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"),
+				cmux.HTTP2MatchHeaderFieldPrefixSendSettings("content-type", "application/grpc+"),
+			)
+		case a.serveHttp:
+			// grpc over tls is served by http server
+			httpLis = m.Match(cmux.TLS())
+		default:
+			grpcLis = m.Match(cmux.TLS())
+		}
+		if a.adminServer != nil {
+			adminLis = m.Match(a.matchAdmin)
+		}
+	}
+	a.serve(grpcLis, httpLis, adminLis)
+	a.addrMu.Lock()
+	a.grpcAddr = lis.Addr()
+	a.addrMu.Unlock()
+	go a.serveMux(m)
+	return nil
+}
+
+// matchAdmin matches HTTP/1 requests to paths registered on admin server.
+func (a *app) matchAdmin(r io.Reader) bool {
+	req, err := http.ReadRequest(bufio.NewReader(r))
+	if err != nil || req.ProtoMajor != 1 {
+		return false
+	}
+	mux, ok := a.adminServer.Handler.(*http.ServeMux)
+	if !ok {
+		return false
+	}
+	_, pattern := mux.Handler(req)
+	return pattern != ""
+}
+
+func (a *app) serveMux(m cmux.CMux) {
+	// listener is closed by any of the servers on shutdown
+	if err := m.Serve(); err != nil && !errors.Is(err, net.ErrClosed) {
+		a.errCh <- newError(PhaseServe, "failed to serve single port", err)
+	}
+}
+
+// isMuxClosed reports whether err is returned by multiplexed listener after
+// the shared listener is closed.
+func isMuxClosed(err error) bool {
+	return errors.Is(err, cmux.ErrServerClosed) || errors.Is(err, cmux.ErrListenerClosed)
+}
@@ -0,0 +1,152 @@
+package grpcapp
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func Test_app_listenSingle(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	h2cClient := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	tlsClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	// connections are dispatched by their first request, so they cannot be
+	// reused for both http and admin requests
+	httpClient := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	type request struct {
+		name   string
+		client *http.Client
+		url    string
+		want   string
+	}
+	tests := []struct {
+		name     string
+		cfg      *Config
+		noHTTP   bool
+		grpcOpts []grpc.DialOption
+		requests []request
+	}{
+		{
+			name: "tls",
+			cfg:  &Config{TLSCertificate: certFile, TLSKey: keyFile},
+			grpcOpts: []grpc.DialOption{
+				grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+			},
+			requests: []request{
+				{"https", tlsClient, "https://%s/v1/health", `"SERVING"`},
+				{"admin", httpClient, "http://%s/methods", "grpc.health.v1.Health/Check"},
+			},
+		},
+		{
+			name: "h2c",
+			cfg:  &Config{HttpAllowH2C: true},
+			grpcOpts: []grpc.DialOption{
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			},
+			requests: []request{
+				{"http/1.1", httpClient, "http://%s/v1/health", `"SERVING"`},
+				{"h2c", h2cClient, "http://%s/v1/health", `"SERVING"`},
+				{"admin", httpClient, "http://%s/methods", "grpc.health.v1.Health/Check"},
+			},
+		},
+		{
+			name:   "plaintext grpc",
+			cfg:    &Config{},
+			noHTTP: true,
+			grpcOpts: []grpc.DialOption{
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			},
+			requests: []request{
+				{"admin", httpClient, "http://%s/methods", "grpc.health.v1.Health/Check"},
+			},
+		},
+		{
+			name:   "tls grpc",
+			cfg:    &Config{TLSCertificate: certFile, TLSKey: keyFile},
+			noHTTP: true,
+			grpcOpts: []grpc.DialOption{
+				grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+			},
+			requests: []request{
+				{"admin", httpClient, "http://%s/methods", "grpc.health.v1.Health/Check"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.LogLevel = "info"
+			tt.cfg.SinglePort = true
+			tt.cfg.AdminListenAddr = ":0"
+			options := []Option{WithConfig(tt.cfg)}
+			if !tt.noHTTP {
+				options = append(options, WithHTTP(), WithGateway(registerHealthGateway))
+			}
+			a := New(options...)
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- a.Run(context.Background())
+			}()
+			<-a.Ready()
+
+			addr := a.GrpcAddr().String()
+			if a.AdminAddr().String() != addr {
+				t.Errorf("expected single address %s, got admin %s", addr, a.AdminAddr())
+			}
+			if tt.noHTTP && a.HttpAddr() != nil {
+				t.Errorf("unexpected http address %s", a.HttpAddr())
+			}
+			if !tt.noHTTP && a.HttpAddr().String() != addr {
+				t.Errorf("expected single address %s, got http %s", addr, a.HttpAddr())
+			}
+
+			for _, opt := range tt.grpcOpts {
+				conn, err := grpc.Dial(addr, opt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+				_ = conn.Close()
+				if err != nil {
+					t.Errorf("grpc Check() error = %v", err)
+				}
+			}
+
+			for _, r := range tt.requests {
+				res, err := r.client.Get(strings.Replace(r.url, "%s", addr, 1))
+				if err != nil {
+					t.Errorf("%s request error = %v", r.name, err)
+					continue
+				}
+				body, _ := io.ReadAll(res.Body)
+				_ = res.Body.Close()
+				if res.StatusCode != http.StatusOK || !strings.Contains(string(body), r.want) {
+					t.Errorf("%s unexpected response %d: %s", r.name, res.StatusCode, body)
+				}
+			}
+
+			if err := a.Stop(context.Background()); err != nil {
+				t.Errorf("Stop() error = %v", err)
+			}
+			if err := <-errCh; err != nil {
+				t.Errorf("Run() error = %v", err)
+			}
+		})
+	}
+}
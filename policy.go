@@ -0,0 +1,408 @@
+package grpcapp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy of per-method authorization of Principal evaluated after JWT or
+// Authenticator authentication. Rules are matched in order, the first rule
+// matching the method is applied, in addition to auth options of WithProtoAuth.
+// Methods matched by a rule are authenticated unless the rule is public,
+// regardless of methods of WithJwtAuthentication and WithAuthenticator options.
+// Calls of the health service (grpc.health.v1.Health) are always allowed.
+type Policy struct {
+
+	// Rules of the policy.
+	Rules []PolicyRule `json:"rules" yaml:"rules"`
+
+	// RolesClaim name of the claim with roles (default "roles"), may be a
+	// dotted path to nested claim, e.g. "realm_access.roles".
+	RolesClaim string `json:"rolesClaim" yaml:"rolesClaim"`
+
+	// DenyUnmatched denies methods not matched by any rule, which are allowed
+	// otherwise.
+	DenyUnmatched bool `json:"denyUnmatched" yaml:"denyUnmatched"`
+}
+
+// PolicyRule of authorization Policy. The rule requires authenticated principal
+// (unless public), all of its scopes and claim expressions and any of its roles.
+type PolicyRule struct {
+
+	// Name of the rule reported in logs when it denies a call.
+	Name string `json:"name" yaml:"name"`
+
+	// Methods full names matched by the rule, "*" matches any method, other
+	// patterns use path.Match syntax, e.g. "/pkg.Greeter/*".
+	Methods []string `json:"methods" yaml:"methods"`
+
+	// Public allows calls without authenticated token, which is not parsed.
+	Public bool `json:"public" yaml:"public"`
+
+	// Scopes required, granted to JWT principal in "scope" (space separated)
+	// or "scp" claim.
+	Scopes []string `json:"scopes" yaml:"scopes"`
+
+	// Roles any of which is required in roles claim.
+	Roles []string `json:"roles" yaml:"roles"`
+
+	// Claims expressions required to be true, "<claim>" (present and not
+	// false or empty), "<claim> == <value>", "<claim> != <value>",
+	// "<claim> in <value>,<value>" or "<claim> contains <value>" (for list
+	// claims). Claim may be a dotted path to nested claim.
+	Claims []string `json:"claims" yaml:"claims"`
+}
+
+// LoadPolicy from YAML or JSON file, unknown (e.g. misspelled) fields are an error.
+func LoadPolicy(name string) (*Policy, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	policy := new(Policy)
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err = dec.Decode(policy); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", name, err)
+	}
+	return policy, nil
+}
+
+// WithAuthorizationPolicy enables authorization of calls with policy. Policy file may
+// be provided with AUTHORIZATION_POLICY_FILE environment variable instead.
+func WithAuthorizationPolicy(policy *Policy) Option {
+	return &policyOption{policy}
+}
+
+type policyOption struct {
+	policy *Policy
+}
+
+func (opt *policyOption) option(a *app) {
+	a.policy = opt.policy
+}
+
+func (a *app) initPolicy() error {
+	if a.policy == nil && a.tools.cfg.AuthorizationPolicyFile != "" {
+		policy, err := LoadPolicy(a.tools.cfg.AuthorizationPolicyFile)
+		if err != nil {
+			return newError(PhaseConfig, "failed to load authorization policy", err)
+		}
+		a.policy = policy
+	}
+	if a.policy == nil {
+		return nil
+	}
+	compiled, err := compilePolicy(a.policy)
+	if err != nil {
+		return newError(PhaseConfig, "invalid authorization policy", err)
+	}
+	a.compiledPolicy = compiled
+	a.tools.log.Info("loaded authorization policy",
+		zap.Int("rules", len(a.policy.Rules)))
+	return nil
+}
+
+type compiledPolicy struct {
+	rules         []compiledRule
+	proto         []compiledRule // applied in addition to rules
+	rolesClaim    []string
+	denyUnmatched bool
+}
+
+type compiledRule struct {
+	PolicyRule
+	claims []claimExpr
+}
+
+func compilePolicy(p *Policy) (*compiledPolicy, error) {
+	rolesClaim := p.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+	c := &compiledPolicy{
+		rules:         make([]compiledRule, len(p.Rules)),
+		rolesClaim:    strings.Split(rolesClaim, "."),
+		denyUnmatched: p.DenyUnmatched,
+	}
+	for i, rule := range p.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("#%d", i)
+		}
+		if len(rule.Methods) == 0 {
+			return nil, fmt.Errorf("rule %s has no methods", rule.Name)
+		}
+		if err := checkPatterns(rule.Methods); err != nil {
+			return nil, fmt.Errorf("rule %s has invalid methods: %w", rule.Name, err)
+		}
+		c.rules[i].PolicyRule = rule
+		for _, expr := range rule.Claims {
+			e, err := parseClaimExpr(expr)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+			c.rules[i].claims = append(c.rules[i].claims, e)
+		}
+	}
+	return c, nil
+}
+
+// match returns rules applying to method, the first matching proto auth rule
+// and the first matching policy rule.
+func (p *compiledPolicy) match(method string) []*compiledRule {
+	var rules []*compiledRule
+	if rule := firstMatch(p.proto, method); rule != nil {
+		rules = append(rules, rule)
+	}
+	if rule := firstMatch(p.rules, method); rule != nil {
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// firstMatch returns the first of rules matching method or nil.
+func firstMatch(rules []compiledRule, method string) *compiledRule {
+	for i := range rules {
+		if matchMethod(rules[i].Methods, method) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// requiresAuth reports whether any rule applying to method requires
+// authentication, ok is false if no rule applies or policy is nil.
+func (p *compiledPolicy) requiresAuth(method string) (required bool, ok bool) {
+	if p == nil {
+		return false, false
+	}
+	rules := p.match(method)
+	for _, rule := range rules {
+		if !rule.Public {
+			return true, true
+		}
+	}
+	return false, len(rules) > 0
+}
+
+// authorize returns reason of denial or empty string if principal satisfies rule.
+// Roles of JWT principal are read from roles claim, claim expressions are
+// evaluated against JWT claims only.
+func (p *compiledPolicy) authorize(rule *compiledRule, principal *Principal) string {
+	for _, scope := range rule.Scopes {
+		if !contains(principal.Scopes, scope) {
+			return "missing scope " + scope
+		}
+	}
+	claims := principal.Claims
+	if len(rule.Roles) > 0 {
+		roles := principal.Roles
+		if claims != nil {
+			roles = stringList(lookupClaim(claims, p.rolesClaim))
+		}
+		found := false
+		for _, role := range rule.Roles {
+			if contains(roles, role) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "missing role"
+		}
+	}
+	for _, e := range rule.claims {
+		if !e.eval(claims) {
+			return "claim expression is false: " + e.expr
+		}
+	}
+	return ""
+}
+
+func makePolicyInterceptors(p *compiledPolicy, log *zap.Logger) (
+	grpc.UnaryServerInterceptor,
+	grpc.StreamServerInterceptor,
+) {
+	authorize := func(ctx context.Context, method string) error {
+		if healthMethod(method) {
+			return nil
+		}
+		rules := p.match(method)
+		if len(rules) == 0 {
+			if p.denyUnmatched {
+				log.Warn("authorization denied",
+					zap.String("method", method),
+					zap.String("reason", "no matching rule"))
+				return status.Error(codes.PermissionDenied, "permission denied")
+			}
+			return nil
+		}
+		principal := principalFrom(ctx)
+		for _, rule := range rules {
+			if rule.Public {
+				continue
+			}
+			if principal == nil {
+				log.Debug("authorization requires authentication",
+					zap.String("method", method),
+					zap.String("rule", rule.Name))
+				return status.Error(codes.Unauthenticated, "unauthenticated")
+			}
+			if reason := p.authorize(rule, principal); reason != "" {
+				log.Warn("authorization denied",
+					zap.String("method", method),
+					zap.String("rule", rule.Name),
+					zap.String("reason", reason),
+					zap.String("sub", principal.Subject))
+				return status.Error(codes.PermissionDenied, "permission denied")
+			}
+		}
+		return nil
+	}
+
+	unaryInterceptor := func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		if err := authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+
+	streamInterceptor := func(
+		srv any,
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := authorize(stream.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+
+	return unaryInterceptor, streamInterceptor
+}
+
+type claimExpr struct {
+	expr   string
+	claim  []string
+	op     string
+	values []string
+}
+
+func parseClaimExpr(expr string) (claimExpr, error) {
+	fields := strings.Fields(expr)
+	e := claimExpr{expr: expr}
+	switch {
+	case len(fields) == 1:
+		e.op = "exists"
+	case len(fields) == 3:
+		e.op = fields[1]
+		switch e.op {
+		case "==", "!=", "contains":
+			e.values = []string{fields[2]}
+		case "in":
+			e.values = strings.Split(fields[2], ",")
+		default:
+			return e, fmt.Errorf("unsupported operator in claim expression %q", expr)
+		}
+	default:
+		return e, fmt.Errorf("invalid claim expression %q", expr)
+	}
+	e.claim = strings.Split(fields[0], ".")
+	return e, nil
+}
+
+func (e claimExpr) eval(claims jwt.MapClaims) bool {
+	v := lookupClaim(claims, e.claim)
+	switch e.op {
+	case "exists":
+		switch t := v.(type) {
+		case nil:
+			return false
+		case bool:
+			return t
+		case string:
+			return t != ""
+		case []any:
+			return len(t) > 0
+		}
+		return true
+	case "==":
+		return v != nil && fmt.Sprint(v) == e.values[0]
+	case "!=":
+		return v == nil || fmt.Sprint(v) != e.values[0]
+	case "in":
+		return v != nil && contains(e.values, fmt.Sprint(v))
+	case "contains":
+		return contains(stringList(v), e.values[0])
+	}
+	return false
+}
+
+// lookupClaim by path of nested claim names.
+func lookupClaim(claims jwt.MapClaims, path []string) any {
+	var v any = map[string]any(claims)
+	for _, name := range path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
+
+// scopes from "scope" claim (space separated) or "scp" claim (list or space
+// separated).
+func scopes(claims jwt.MapClaims) []string {
+	if s, ok := claims["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+	if s, ok := claims["scp"].(string); ok {
+		return strings.Fields(s)
+	}
+	return stringList(claims["scp"])
+}
+
+// stringList of claim value being a list or a single string.
+func stringList(v any) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	case []any:
+		list := make([]string, 0, len(t))
+		for _, item := range t {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
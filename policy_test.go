@@ -0,0 +1,348 @@
+package grpcapp
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const testPolicyYAML = `
+rolesClaim: realm_access.roles
+denyUnmatched: true
+rules:
+  - name: public health
+    methods: ["/grpc.health.v1.Health/*"]
+    public: true
+  - name: greeter admin
+    methods: [/pkg.Greeter/Delete]
+    roles: [admin]
+  - name: greeter
+    methods: [/pkg.Greeter/*]
+    scopes: [greeter.read]
+    claims: ["tenant in acme,globex", email_verified]
+`
+
+const testPolicyJSON = `{
+  "rolesClaim": "realm_access.roles",
+  "denyUnmatched": true,
+  "rules": [
+    {"name": "public health", "methods": ["/grpc.health.v1.Health/*"], "public": true},
+    {"name": "greeter admin", "methods": ["/pkg.Greeter/Delete"], "roles": ["admin"]},
+    {"name": "greeter", "methods": ["/pkg.Greeter/*"], "scopes": ["greeter.read"], "claims": ["tenant in acme,globex", "email_verified"]}
+  ]
+}`
+
+func testPolicy() *Policy {
+	return &Policy{
+		RolesClaim:    "realm_access.roles",
+		DenyUnmatched: true,
+		Rules: []PolicyRule{
+			{Name: "public health", Methods: []string{"/grpc.health.v1.Health/*"}, Public: true},
+			{Name: "greeter admin", Methods: []string{"/pkg.Greeter/Delete"}, Roles: []string{"admin"}},
+			{
+				Name:    "greeter",
+				Methods: []string{"/pkg.Greeter/*"},
+				Scopes:  []string{"greeter.read"},
+				Claims:  []string{"tenant in acme,globex", "email_verified"},
+			},
+		},
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile, jsonFile, badFile := filepath.Join(dir, "policy.yaml"), filepath.Join(dir, "policy.json"), filepath.Join(dir, "bad.yaml")
+	writeTestFile(t, yamlFile, []byte(testPolicyYAML))
+	writeTestFile(t, jsonFile, []byte(testPolicyJSON))
+	writeTestFile(t, badFile, []byte("rules: {"))
+	unknownFile, unknownRuleFile, emptyFile := filepath.Join(dir, "unknown.yaml"), filepath.Join(dir, "unknown-rule.yaml"), filepath.Join(dir, "empty.yaml")
+	writeTestFile(t, unknownFile, []byte("denyUnmached: true\n"))
+	writeTestFile(t, unknownRuleFile, []byte("rules:\n  - methods: [\"*\"]\n    role: [admin]\n"))
+	writeTestFile(t, emptyFile, nil)
+	tests := []struct {
+		name    string
+		file    string
+		want    *Policy
+		wantErr bool
+	}{
+		{"yaml", yamlFile, testPolicy(), false},
+		{"json", jsonFile, testPolicy(), false},
+		{"invalid", badFile, nil, true},
+		{"misspelled field", unknownFile, nil, true},
+		{"misspelled rule field", unknownRuleFile, nil, true},
+		{"empty", emptyFile, &Policy{}, false},
+		{"not found", filepath.Join(dir, "none.yaml"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadPolicy(tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadPolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_compilePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    PolicyRule
+		wantErr bool
+	}{
+		{"valid", PolicyRule{Methods: []string{"*"}, Claims: []string{"sub != admin"}}, false},
+		{"without methods", PolicyRule{}, true},
+		{"invalid pattern", PolicyRule{Methods: []string{"/pkg.Svc/["}}, true},
+		{"invalid expression", PolicyRule{Methods: []string{"*"}, Claims: []string{"sub =="}}, true},
+		{"invalid operator", PolicyRule{Methods: []string{"*"}, Claims: []string{"sub ~ admin"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compilePolicy(&Policy{Rules: []PolicyRule{tt.rule}}); (err != nil) != tt.wantErr {
+				t.Errorf("compilePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_claimExpr_eval(t *testing.T) {
+	claims := jwt.MapClaims{
+		"sub":            "user",
+		"email_verified": false,
+		"level":          float64(3),
+		"groups":         []any{"dev", "ops"},
+		"org":            map[string]any{"id": "acme"},
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"sub", true},
+		{"missing", false},
+		{"email_verified", false},
+		{"sub == user", true},
+		{"sub == other", false},
+		{"level == 3", true},
+		{"sub != other", true},
+		{"missing != other", true},
+		{"org.id in acme,globex", true},
+		{"org.id in globex", false},
+		{"groups contains ops", true},
+		{"groups contains qa", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := parseClaimExpr(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := e.eval(claims); got != tt.want {
+				t.Errorf("eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_makePolicyInterceptors(t *testing.T) {
+	policy, err := compilePolicy(testPolicy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	core, logs := observer.New(zap.WarnLevel)
+	unary, stream := makePolicyInterceptors(policy, zap.New(core))
+
+	allowed := jwt.MapClaims{
+		"sub":            "user",
+		"scope":          "openid greeter.read",
+		"tenant":         "acme",
+		"email_verified": true,
+		"realm_access":   map[string]any{"roles": []any{"admin"}},
+	}
+	with := func(key string, value any) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		for k, v := range allowed {
+			claims[k] = v
+		}
+		claims[key] = value
+		return claims
+	}
+	tests := []struct {
+		name     string
+		method   string
+		claims   jwt.MapClaims
+		want     codes.Code
+		wantRule string
+	}{
+		{"public", "/grpc.health.v1.Health/Check", nil, codes.OK, ""},
+		{"unauthenticated", "/pkg.Greeter/Hello", nil, codes.Unauthenticated, ""},
+		{"allowed", "/pkg.Greeter/Hello", allowed, codes.OK, ""},
+		{"without scope", "/pkg.Greeter/Hello", with("scope", nil), codes.PermissionDenied, "greeter"},
+		{"missing scope", "/pkg.Greeter/Hello", with("scope", "openid"), codes.PermissionDenied, "greeter"},
+		{"claim expression", "/pkg.Greeter/Hello", with("tenant", "other"), codes.PermissionDenied, "greeter"},
+		{"role", "/pkg.Greeter/Delete", allowed, codes.OK, ""},
+		{"missing role", "/pkg.Greeter/Delete", with("realm_access", map[string]any{"roles": []any{"user"}}), codes.PermissionDenied, "greeter admin"},
+		{"unmatched", "/pkg.Other/Method", allowed, codes.PermissionDenied, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.claims != nil {
+				ctx = context.WithValue(ctx, TokenContextKey, &jwt.Token{Claims: tt.claims})
+			}
+			_ = logs.TakeAll()
+			_, err := unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, func(context.Context, any) (any, error) {
+				return nil, nil
+			})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("unary code = %v, want %v", got, tt.want)
+			}
+			err = stream(nil, &grpcStreamWrapper{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: tt.method}, func(any, grpc.ServerStream) error {
+				return nil
+			})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("stream code = %v, want %v", got, tt.want)
+			}
+			if tt.wantRule != "" {
+				entries := logs.FilterField(zap.String("rule", tt.wantRule)).All()
+				if len(entries) != 2 {
+					t.Errorf("expected denial by rule %q logged twice, got %v", tt.wantRule, logs.All())
+				}
+			}
+		})
+	}
+}
+
+func Test_app_initPolicy(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, file, []byte(testPolicyYAML))
+	badFile := filepath.Join(t.TempDir(), "bad.yaml")
+	writeTestFile(t, badFile, []byte("rules: [{name: bad}]"))
+	tests := []struct {
+		name       string
+		cfg        *Config
+		options    []Option
+		wantPolicy bool
+		wantErr    bool
+	}{
+		{"without policy", &Config{}, nil, false, false},
+		{"with option", &Config{}, []Option{WithAuthorizationPolicy(testPolicy())}, true, false},
+		{"with file", &Config{AuthorizationPolicyFile: file}, nil, true, false},
+		{"invalid file", &Config{AuthorizationPolicyFile: badFile}, nil, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(append(tt.options, WithConfig(tt.cfg), WithLogger(zap.NewNop()))...).(*app)
+			err := a.initPolicy()
+			var appErr *Error
+			if tt.wantErr != (err != nil) || (err != nil && (!errors.As(err, &appErr) || appErr.Phase != PhaseConfig)) {
+				t.Errorf("initPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (a.compiledPolicy != nil) != tt.wantPolicy {
+				t.Errorf("expected policy %v", tt.wantPolicy)
+			}
+		})
+	}
+}
+
+func Test_app_policyAuthentication(t *testing.T) {
+	secret := []byte("secret")
+	keyFunc := func(*jwt.Token) (any, error) {
+		return secret, nil
+	}
+	sign := func(role string) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user", "roles": []string{role}}).SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	publicWhoami := &Policy{Rules: []PolicyRule{{Methods: []string{"/grpcapp.test.Whoami/*"}, Public: true}}}
+	adminWhoami := &Policy{Rules: []PolicyRule{{Methods: []string{"/grpcapp.test.Whoami/*"}, Roles: []string{"admin"}}}}
+
+	type call struct {
+		token string
+		want  codes.Code
+	}
+	tests := []struct {
+		name    string
+		options []Option
+		calls   []call
+	}{
+		{"public rule skips jwt authentication", []Option{
+			WithJwtAuthentication(keyFunc),
+			WithAuthorizationPolicy(publicWhoami),
+		}, []call{
+			{"", codes.OK},
+		}},
+		{"rule requires jwt authentication", []Option{
+			WithJwtAuthentication(keyFunc, "/other.Svc/M"),
+			WithAuthorizationPolicy(adminWhoami),
+		}, []call{
+			{"", codes.Unauthenticated},
+			{"invalid", codes.Unauthenticated},
+			{sign("user"), codes.PermissionDenied},
+			{sign("admin"), codes.OK},
+		}},
+		{"public rule skips authenticator", []Option{
+			WithAuthenticator(JwtAuthenticator(keyFunc)),
+			WithAuthorizationPolicy(publicWhoami),
+		}, []call{
+			{"", codes.OK},
+		}},
+		{"rule requires authenticator", []Option{
+			WithAuthenticator(JwtAuthenticator(keyFunc), "/other.Svc/M"),
+			WithAuthorizationPolicy(adminWhoami),
+		}, []call{
+			{"", codes.Unauthenticated},
+			{sign("user"), codes.PermissionDenied},
+			{sign("admin"), codes.OK},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(append(tt.options,
+				WithConfig(&Config{LogLevel: "info"}),
+				WithServiceImplementation(whoamiServiceDesc(), new(whoamiImplementation)),
+			)...)
+			go func() {
+				_ = a.Run(context.Background())
+			}()
+			<-a.Ready()
+			defer func() {
+				_ = a.Stop(context.Background())
+			}()
+			conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+			for _, c := range tt.calls {
+				ctx := context.Background()
+				if c.token != "" {
+					ctx = metadata.AppendToOutgoingContext(ctx, "authorization", c.token)
+				}
+				err := conn.Invoke(ctx, "/grpcapp.test.Whoami/Public", new(emptypb.Empty), new(wrapperspb.StringValue))
+				if got := status.Code(err); got != c.want {
+					t.Errorf("Public() with token %q code = %v, want %v", c.token, got, c.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package grpcapp
+
+import (
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/skamenetskiy/grpcapp/authpb"
+)
+
+// WithProtoAuth enables auth requirements declared with (grpcapp.auth) method option
+// (see proto/grpcapp/auth.proto) of services registered with WithServiceImplementation.
+// Annotated methods require JWT or Authenticator authentication if required or with
+// scopes or roles and are authorized with them. The matching authorization Policy
+// rule is applied as well, calls must satisfy both. Public methods are allowed
+// without authentication unless required by the Policy, methods annotated as
+// neither public nor required are left to the Policy and authentication options.
+// With failClosed methods without the option require authentication as well.
+func WithProtoAuth(failClosed bool) Option {
+	return &protoAuthOption{failClosed}
+}
+
+type protoAuthOption struct {
+	failClosed bool
+}
+
+func (opt *protoAuthOption) option(a *app) {
+	a.protoAuth = true
+	a.protoAuthFailClosed = opt.failClosed
+}
+
+// initProtoAuth reads auth options of registered services into policy rules,
+// which select methods requiring authentication as well.
+func (a *app) initProtoAuth() {
+	if !a.protoAuth || a.compiledPolicy == nil {
+		return
+	}
+	var rules []compiledRule
+	requireAuth := false
+	for _, si := range a.serviceImplementations {
+		methods := make([]string, 0, len(si.desc.Methods)+len(si.desc.Streams))
+		for _, m := range si.desc.Methods {
+			methods = append(methods, m.MethodName)
+		}
+		for _, s := range si.desc.Streams {
+			methods = append(methods, s.StreamName)
+		}
+		for _, name := range methods {
+			fullMethod := "/" + si.desc.ServiceName + "/" + name
+			auth := methodAuth(si.desc, name)
+			switch {
+			case auth != nil && auth.Public:
+				rules = append(rules, compiledRule{PolicyRule: PolicyRule{
+					Name:    "proto " + fullMethod,
+					Methods: []string{fullMethod},
+					Public:  true,
+				}})
+			case auth != nil && (auth.Required || len(auth.Scopes)+len(auth.Roles) > 0):
+				rules = append(rules, compiledRule{PolicyRule: PolicyRule{
+					Name:    "proto " + fullMethod,
+					Methods: []string{fullMethod},
+					Scopes:  auth.Scopes,
+					Roles:   auth.Roles,
+				}})
+				requireAuth = true
+			case auth != nil:
+				// not required, left to policy rules and authentication methods
+			case a.protoAuthFailClosed:
+				rules = append(rules, compiledRule{PolicyRule: PolicyRule{
+					Name:    "proto fail closed",
+					Methods: []string{fullMethod},
+				}})
+				requireAuth = true
+			}
+		}
+	}
+	// authentication of methods is selected by policy rules
+	a.compiledPolicy.proto = rules
+	if a.tools.jwt == nil && a.authn == nil && requireAuth {
+		a.tools.log.Warn("proto auth options require authentication, which is not enabled")
+	}
+	a.tools.log.Info("loaded proto auth options",
+		zap.Int("methods", len(rules)),
+		zap.Bool("failClosed", a.protoAuthFailClosed))
+}
+
+// methodAuth option of method from service descriptor in global registry or
+// nil if not found.
+func methodAuth(desc *grpc.ServiceDesc, name string) *authpb.Auth {
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(desc.ServiceName))
+	if err != nil {
+		return nil
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil
+	}
+	md := sd.Methods().ByName(protoreflect.Name(name))
+	if md == nil {
+		return nil
+	}
+	opts, ok := md.Options().(*descriptorpb.MethodOptions)
+	if !ok || !proto.HasExtension(opts, authpb.E_Auth) {
+		return nil
+	}
+	auth, _ := proto.GetExtension(opts, authpb.E_Auth).(*authpb.Auth)
+	return auth
+}
@@ -0,0 +1,203 @@
+package grpcapp
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/skamenetskiy/grpcapp/authpb"
+)
+
+var registerGreeterOnce sync.Once
+
+// registerGreeterDescriptor registers descriptor of grpcapp.test.Greeter service
+// annotated with auth options, as generated code would do.
+func registerGreeterDescriptor(t *testing.T) {
+	registerGreeterOnce.Do(func() {
+		method := func(name string, auth *authpb.Auth) *descriptorpb.MethodDescriptorProto {
+			m := &descriptorpb.MethodDescriptorProto{
+				Name:       proto.String(name),
+				InputType:  proto.String(".google.protobuf.Empty"),
+				OutputType: proto.String(".google.protobuf.Empty"),
+			}
+			if auth != nil {
+				m.Options = &descriptorpb.MethodOptions{}
+				proto.SetExtension(m.Options, authpb.E_Auth, auth)
+			}
+			return m
+		}
+		fdp := &descriptorpb.FileDescriptorProto{
+			Name:       proto.String("grpcapp/test/greeter.proto"),
+			Package:    proto.String("grpcapp.test"),
+			Syntax:     proto.String("proto3"),
+			Dependency: []string{emptypb.File_google_protobuf_empty_proto.Path()},
+			Service: []*descriptorpb.ServiceDescriptorProto{{
+				Name: proto.String("Greeter"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					method("Public", &authpb.Auth{Public: true}),
+					method("Required", &authpb.Auth{Required: true}),
+					method("Read", &authpb.Auth{Scopes: []string{"greeter.read"}}),
+					method("Optional", &authpb.Auth{Required: false}),
+					method("Plain", nil),
+				},
+			}},
+		}
+		fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func greeterServiceDesc() *grpc.ServiceDesc {
+	desc := &grpc.ServiceDesc{
+		ServiceName: "grpcapp.test.Greeter",
+		HandlerType: (*any)(nil),
+	}
+	for _, name := range []string{"Public", "Required", "Read", "Optional", "Plain"} {
+		desc.Methods = append(desc.Methods, unaryMethodDesc(desc.ServiceName, name, nil, func(any, context.Context, any) (any, error) {
+			return new(emptypb.Empty), nil
+		}))
+	}
+	return desc
+}
+
+type greeterImplementation struct{}
+
+func (greeterImplementation) UseTools(_ Tools) {}
+
+func Test_app_protoAuth(t *testing.T) {
+	registerGreeterDescriptor(t)
+	secret := []byte("secret")
+	keyFunc := func(*jwt.Token) (any, error) {
+		return secret, nil
+	}
+	sign := func(scope string, roles ...string) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"scope": scope, "roles": roles}).SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	type call struct {
+		method string
+		token  string
+		want   codes.Code
+	}
+	tests := []struct {
+		name       string
+		failClosed bool
+		policy     *Policy
+		calls      []call
+	}{
+		{
+			name: "fail open",
+			calls: []call{
+				{"Public", "", codes.OK},
+				{"Required", "", codes.Unauthenticated},
+				{"Required", sign(""), codes.OK},
+				{"Read", sign("other"), codes.PermissionDenied},
+				{"Read", sign("greeter.read"), codes.OK},
+				{"Optional", "", codes.OK},
+				{"Plain", "", codes.OK},
+			},
+		},
+		{
+			name:       "fail closed",
+			failClosed: true,
+			calls: []call{
+				{"Public", "", codes.OK},
+				{"Optional", "", codes.OK},
+				{"Plain", "", codes.Unauthenticated},
+				{"Plain", sign(""), codes.OK},
+			},
+		},
+		{
+			name: "with policy",
+			policy: &Policy{Rules: []PolicyRule{
+				{Methods: []string{"/grpcapp.test.Greeter/*"}, Roles: []string{"admin"}},
+			}},
+			calls: []call{
+				{"Public", "", codes.Unauthenticated},
+				{"Public", sign(""), codes.PermissionDenied},
+				{"Public", sign("", "admin"), codes.OK},
+				{"Required", sign(""), codes.PermissionDenied},
+				{"Required", sign("", "admin"), codes.OK},
+				{"Read", sign("greeter.read"), codes.PermissionDenied},
+				{"Read", sign("", "admin"), codes.PermissionDenied},
+				{"Read", sign("greeter.read", "admin"), codes.OK},
+				{"Optional", sign(""), codes.PermissionDenied},
+				{"Plain", sign("", "admin"), codes.OK},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := []Option{
+				WithConfig(&Config{LogLevel: "info"}),
+				// methods list is overridden by proto options
+				WithJwtAuthentication(keyFunc, "/grpcapp.test.Greeter/Public"),
+				WithProtoAuth(tt.failClosed),
+				WithServiceImplementation(greeterServiceDesc(), greeterImplementation{}),
+			}
+			if tt.policy != nil {
+				options = append(options, WithAuthorizationPolicy(tt.policy))
+			}
+			a := New(options...)
+			go func() {
+				_ = a.Run(context.Background())
+			}()
+			<-a.Ready()
+			defer func() {
+				_ = a.Stop(context.Background())
+			}()
+			conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+			for _, c := range tt.calls {
+				ctx := context.Background()
+				if c.token != "" {
+					ctx = metadata.AppendToOutgoingContext(ctx, "authorization", c.token)
+				}
+				err := conn.Invoke(ctx, "/grpcapp.test.Greeter/"+c.method, new(emptypb.Empty), new(emptypb.Empty))
+				if got := status.Code(err); got != c.want {
+					t.Errorf("%s with token %v code = %v, want %v", c.method, c.token != "", got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_methodAuth(t *testing.T) {
+	registerGreeterDescriptor(t)
+	desc := greeterServiceDesc()
+	if auth := methodAuth(desc, "Read"); auth == nil || len(auth.Scopes) != 1 || auth.Scopes[0] != "greeter.read" {
+		t.Errorf("unexpected Read auth %v", auth)
+	}
+	if auth := methodAuth(desc, "Plain"); auth != nil {
+		t.Errorf("unexpected Plain auth %v", auth)
+	}
+	if auth := methodAuth(&grpc.ServiceDesc{ServiceName: "unknown.Service"}, "Method"); auth != nil {
+		t.Errorf("unexpected unknown service auth %v", auth)
+	}
+}
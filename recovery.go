@@ -0,0 +1,90 @@
+package grpcapp
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PanicHandler maps value p of panic recovered in a call to status error returned
+// to the client.
+type PanicHandler func(ctx context.Context, p any) error
+
+// WithPanicHandler replaces the default PanicHandler returning codes.Internal. Panics
+// are recovered, logged with stack trace and counted in metrics regardless of
+// the handler. This option is ignored if WithGrpcServer option is used.
+func WithPanicHandler(handler PanicHandler) Option {
+	return &panicHandlerOption{handler}
+}
+
+type panicHandlerOption struct {
+	handler PanicHandler
+}
+
+func (opt *panicHandlerOption) option(a *app) {
+	a.panicHandler = opt.handler
+}
+
+func defaultPanicHandler(context.Context, any) error {
+	return status.Error(codes.Internal, "internal error")
+}
+
+func (a *app) makeRecoveryInterceptors() (
+	grpc.UnaryServerInterceptor,
+	grpc.StreamServerInterceptor,
+) {
+	handlePanic := a.panicHandler
+	if handlePanic == nil {
+		handlePanic = defaultPanicHandler
+	}
+
+	recovered := func(ctx context.Context, method string, p any) error {
+		a.tools.log.With(ctxzap.TagsToFields(ctx)...).Error("recovered from panic",
+			zap.String("method", method),
+			zap.Any("panic", p),
+			zap.ByteString("stack", debug.Stack()))
+		if a.metrics != nil {
+			service, name := splitMethod(method)
+			a.metrics.panics.WithLabelValues(service, name).Inc()
+		}
+		if err := handlePanic(ctx, p); err != nil {
+			return err
+		}
+		return defaultPanicHandler(ctx, p)
+	}
+
+	unaryInterceptor := func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (res any, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				res, err = nil, recovered(ctx, info.FullMethod, p)
+			}
+		}()
+		return handler(ctx, req)
+	}
+
+	streamInterceptor := func(
+		srv any,
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(stream.Context(), info.FullMethod, p)
+			}
+		}()
+		return handler(srv, stream)
+	}
+
+	return unaryInterceptor, streamInterceptor
+}
@@ -0,0 +1,121 @@
+package grpcapp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+var errTestPanic = errors.New("test panic")
+
+// panickingServiceDesc of service panicking with errTestPanic in unary and
+// stream handlers.
+func panickingServiceDesc() *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: "grpcapp.test.Panicking",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{
+			unaryMethodDesc("grpcapp.test.Panicking", "Unary", nil, func(any, context.Context, any) (any, error) {
+				panic(errTestPanic)
+			}),
+		},
+		Streams: []grpc.StreamDesc{{
+			StreamName: "Stream",
+			Handler: func(any, grpc.ServerStream) error {
+				panic(errTestPanic)
+			},
+			ServerStreams: true,
+		}},
+	}
+}
+
+type panickingImplementation struct{}
+
+func (panickingImplementation) UseTools(_ Tools) {}
+
+func Test_app_recovery(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  []Option
+		wantCode codes.Code
+	}{
+		{"default", nil, codes.Internal},
+		{"custom handler", []Option{WithPanicHandler(func(_ context.Context, p any) error {
+			if err, ok := p.(error); ok && errors.Is(err, errTestPanic) {
+				return status.Error(codes.Unavailable, "try again")
+			}
+			return nil
+		})}, codes.Unavailable},
+		{"custom handler without status", []Option{WithPanicHandler(func(context.Context, any) error {
+			return nil
+		})}, codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zap.ErrorLevel)
+			a := New(append(tt.options,
+				WithConfig(&Config{LogLevel: "info"}),
+				WithLogger(zap.New(core)),
+				WithServiceImplementation(panickingServiceDesc(), panickingImplementation{}),
+			)...).(*app)
+			go func() {
+				_ = a.Run(context.Background())
+			}()
+			<-a.Ready()
+			defer func() {
+				_ = a.Stop(context.Background())
+			}()
+			conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+
+			err = conn.Invoke(context.Background(), "/grpcapp.test.Panicking/Unary", new(emptypb.Empty), new(emptypb.Empty))
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("unary code = %v, want %v", got, tt.wantCode)
+			}
+			stream, err := conn.NewStream(context.Background(), &panickingServiceDesc().Streams[0], "/grpcapp.test.Panicking/Stream")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = stream.CloseSend(); err != nil {
+				t.Fatal(err)
+			}
+			err = stream.RecvMsg(new(emptypb.Empty))
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("stream code = %v, want %v", got, tt.wantCode)
+			}
+
+			for _, method := range []string{"Unary", "Stream"} {
+				if got := testutil.ToFloat64(a.metrics.panics.WithLabelValues("grpcapp.test.Panicking", method)); got != 1 {
+					t.Errorf("%s panics = %v, want 1", method, got)
+				}
+				entries := logs.FilterMessage("recovered from panic").
+					FilterField(zap.String("method", "/grpcapp.test.Panicking/"+method)).All()
+				if len(entries) != 1 {
+					t.Fatalf("%s recovered panic logs = %v, want 1", method, len(entries))
+				}
+				fields := entries[0].ContextMap()
+				if stack, _ := fields["stack"].(string); !strings.Contains(stack, "panickingServiceDesc") {
+					t.Errorf("%s stack does not contain panicking function: %s", method, stack)
+				}
+				if fields["panic"] != errTestPanic.Error() {
+					t.Errorf("%s panic = %v", method, fields["panic"])
+				}
+			}
+		})
+	}
+}
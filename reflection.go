@@ -0,0 +1,100 @@
+package grpcapp
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// WithReflection option registers v1 and v1alpha gRPC server reflection services,
+// so tools like grpcurl can be used. This option is ignored if WithGrpcServer
+// option is used.
+func WithReflection() Option {
+	return new(reflectionOption)
+}
+
+type reflectionOption struct{}
+
+func (*reflectionOption) option(a *app) {
+	a.reflection = true
+}
+
+// Stream types of MethodInfo.
+const (
+	StreamTypeUnary        = "unary"
+	StreamTypeClientStream = "client_stream"
+	StreamTypeServerStream = "server_stream"
+	StreamTypeBidiStream   = "bidi_stream"
+)
+
+// MethodInfo describes a method registered on gRPC server.
+type MethodInfo struct {
+
+	// Service full name.
+	Service string `json:"service"`
+
+	// Method name.
+	Method string `json:"method"`
+
+	// FullMethod as seen by interceptors, e.g. "/pkg.Service/Method".
+	FullMethod string `json:"fullMethod"`
+
+	// StreamType of the method.
+	StreamType string `json:"streamType"`
+
+	// Authenticated is true if the method requires WithJwtAuthentication or
+	// WithAuthenticator authentication, considering authorization policy rules.
+	Authenticated bool `json:"authenticated"`
+}
+
+func (a *app) Methods() []MethodInfo {
+	if a.grpcServer == nil {
+		return nil
+	}
+	var methods []MethodInfo
+	for service, info := range a.grpcServer.GetServiceInfo() {
+		for _, m := range info.Methods {
+			fullMethod := "/" + service + "/" + m.Name
+			methods = append(methods, MethodInfo{
+				Service:       service,
+				Method:        m.Name,
+				FullMethod:    fullMethod,
+				StreamType:    streamType(m.IsClientStream, m.IsServerStream),
+				Authenticated: a.authenticates(fullMethod),
+			})
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].FullMethod < methods[j].FullMethod
+	})
+	return methods
+}
+
+// authenticates reports whether calls of method are authenticated, methods are
+// selected the same way as by authentication interceptors.
+func (a *app) authenticates(fullMethod string) bool {
+	if a.jwtEnabled && !a.tools.jwt.skip(fullMethod) {
+		return true
+	}
+	return a.authn != nil && a.authn.authenticator(fullMethod) != nil
+}
+
+func streamType(client, server bool) string {
+	switch {
+	case client && server:
+		return StreamTypeBidiStream
+	case client:
+		return StreamTypeClientStream
+	case server:
+		return StreamTypeServerStream
+	}
+	return StreamTypeUnary
+}
+
+// MethodsHandler returns http.Handler listing App.Methods as JSON.
+func MethodsHandler(a App) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(a.Methods())
+	})
+}
@@ -0,0 +1,130 @@
+package grpcapp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+)
+
+func TestWithReflection(t *testing.T) {
+	a := &app{}
+	WithReflection().option(a)
+	if !a.reflection {
+		t.Error("expected reflection to be enabled")
+	}
+}
+
+func Test_app_Methods(t *testing.T) {
+	keyFunc := func(_ *jwt.Token) (any, error) { return nil, nil }
+	wait := MethodInfo{
+		Service:    "test.Blocking",
+		Method:     "Wait",
+		FullMethod: "/test.Blocking/Wait",
+		StreamType: StreamTypeServerStream,
+	}
+	tests := []struct {
+		name           string
+		options        []Option
+		wantReflection bool
+		wantAuth       bool
+	}{
+		{"basic", nil, false, false},
+		{"with reflection", []Option{WithReflection()}, true, false},
+		{"with jwt", []Option{WithJwtAuthentication(keyFunc)}, false, true},
+		{"with jwt methods", []Option{WithJwtAuthentication(keyFunc, "/test.Other/Method")}, false, false},
+		{"with jwt method pattern", []Option{WithJwtAuthentication(keyFunc, "/test.Blocking/*")}, false, true},
+		{"with jwt any method", []Option{WithJwtAuthentication(keyFunc, "*")}, false, true},
+		{"with authenticator", []Option{WithAuthenticator(JwtAuthenticator(keyFunc))}, false, true},
+		{"with authenticator methods", []Option{WithAuthenticator(JwtAuthenticator(keyFunc), "/test.Other/*")}, false, false},
+		{"with public policy rule", []Option{
+			WithJwtAuthentication(keyFunc),
+			WithAuthorizationPolicy(&Policy{Rules: []PolicyRule{{Methods: []string{"/test.Blocking/*"}, Public: true}}}),
+		}, false, false},
+		{"with policy rule", []Option{
+			WithJwtAuthentication(keyFunc, "/test.Other/Method"),
+			WithAuthorizationPolicy(&Policy{Rules: []PolicyRule{{Methods: []string{"/test.Blocking/*"}, Roles: []string{"admin"}}}}),
+		}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := append([]Option{
+				WithConfig(&Config{}),
+				WithLogger(zap.NewNop()),
+				WithServiceImplementation(&blockingServiceDesc, blockingImplementation{}),
+			}, tt.options...)
+			a := New(options...).(*app)
+			if err := a.initPolicy(); err != nil {
+				t.Fatal(err)
+			}
+			a.initServers()
+			a.initServiceImplementations()
+
+			var gotWait *MethodInfo
+			gotReflection := false
+			for _, m := range a.Methods() {
+				m := m
+				switch m.Service {
+				case "grpc.reflection.v1.ServerReflection", "grpc.reflection.v1alpha.ServerReflection":
+					gotReflection = true
+				case wait.Service:
+					gotWait = &m
+				}
+			}
+			if gotReflection != tt.wantReflection {
+				t.Errorf("expected reflection %v, got %v", tt.wantReflection, gotReflection)
+			}
+			want := wait
+			want.Authenticated = tt.wantAuth
+			if gotWait == nil || !reflect.DeepEqual(*gotWait, want) {
+				t.Errorf("expected %v, got %v", want, gotWait)
+			}
+		})
+	}
+}
+
+func Test_streamType(t *testing.T) {
+	tests := []struct {
+		client, server bool
+		want           string
+	}{
+		{false, false, StreamTypeUnary},
+		{true, false, StreamTypeClientStream},
+		{false, true, StreamTypeServerStream},
+		{true, true, StreamTypeBidiStream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := streamType(tt.client, tt.server); got != tt.want {
+				t.Errorf("streamType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMethodsHandler(t *testing.T) {
+	a := New(
+		WithConfig(&Config{}),
+		WithLogger(zap.NewNop()),
+		WithServiceImplementation(&blockingServiceDesc, blockingImplementation{}),
+	).(*app)
+	a.initServers()
+	a.initServiceImplementations()
+
+	rec := httptest.NewRecorder()
+	MethodsHandler(a).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/methods", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var got []MethodInfo
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, a.Methods()) {
+		t.Errorf("expected %v, got %v", a.Methods(), got)
+	}
+}
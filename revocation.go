@@ -0,0 +1,272 @@
+package grpcapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+// DefaultRevocationPurgeInterval of expired entries of RevocationStore.
+const DefaultRevocationPurgeInterval = 10 * time.Minute
+
+var (
+	// ErrTokenRevoked returned by token revocation check of revoked token.
+	ErrTokenRevoked = errors.New("token is revoked")
+
+	// ErrNoRevocationKey returned by TokenRevocationKey if token has neither
+	// "jti" nor "sub" and "iat" claims.
+	ErrNoRevocationKey = errors.New("token has neither jti nor sub and iat claims")
+)
+
+// RevocationStore of revoked tokens keyed by TokenRevocationKey.
+type RevocationStore interface {
+
+	// Revoke key until expiresAt (the token expiration), zero expiresAt
+	// revokes key forever.
+	Revoke(ctx context.Context, key string, expiresAt time.Time) error
+
+	// IsRevoked reports whether key is revoked.
+	IsRevoked(ctx context.Context, key string) (bool, error)
+
+	// Purge entries expired before t, returns number of purged entries.
+	Purge(ctx context.Context, t time.Time) (int64, error)
+}
+
+// WithTokenRevocation enables revocation check of authenticated JWT tokens against
+// store, revoked tokens are rejected with Unauthenticated. Tokens are revoked with
+// Tools.RevokeToken or RevocationStore.Revoke, expired entries are purged every
+// purgeInterval (DefaultRevocationPurgeInterval if zero, negative disables purge).
+// Store implementing UseTools(Tools) receives Tools on application start.
+func WithTokenRevocation(store RevocationStore, purgeInterval time.Duration) Option {
+	return &revocationOption{store, purgeInterval}
+}
+
+type revocationOption struct {
+	store         RevocationStore
+	purgeInterval time.Duration
+}
+
+func (opt *revocationOption) option(a *app) {
+	a.tools.revocation = opt.store
+	a.revocationPurgeInterval = opt.purgeInterval
+}
+
+// TokenRevocationKey of token claims, "jti:<jti>" or "sub:<sub>:<iat>" if token
+// has no "jti" claim.
+func TokenRevocationKey(claims jwt.MapClaims) (string, error) {
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		return "jti:" + jti, nil
+	}
+	sub, _ := claims["sub"].(string)
+	iat, ok := claims["iat"].(float64)
+	if sub == "" || !ok {
+		return "", ErrNoRevocationKey
+	}
+	return fmt.Sprintf("sub:%s:%d", sub, int64(iat)), nil
+}
+
+// tokenExpiresAt of claims or zero time if token has no "exp" claim.
+func tokenExpiresAt(claims jwt.MapClaims) time.Time {
+	if exp, ok := claims["exp"].(float64); ok {
+		return time.Unix(int64(exp), 0)
+	}
+	return time.Time{}
+}
+
+// RevokeToken revokes token until its expiration, requires WithTokenRevocation option.
+func (t *tools) RevokeToken(ctx context.Context, token *jwt.Token) error {
+	if t.revocation == nil {
+		return errors.New("token revocation is not enabled")
+	}
+	claims, err := mapClaims(token)
+	if err != nil {
+		return err
+	}
+	key, err := TokenRevocationKey(claims)
+	if err != nil {
+		return err
+	}
+	if err = t.revocation.Revoke(ctx, key, tokenExpiresAt(claims)); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	t.log.Info("token revoked",
+		zap.String("key", key))
+	return nil
+}
+
+// checkRevoked returns ErrTokenRevoked if token is revoked, tokens without
+// revocation key can not be revoked and pass the check.
+func (t *tools) checkRevoked(ctx context.Context, token *jwt.Token) error {
+	if t.revocation == nil {
+		return nil
+	}
+	claims, err := mapClaims(token)
+	if err != nil {
+		return err
+	}
+	key, err := TokenRevocationKey(claims)
+	if err != nil {
+		return nil
+	}
+	revoked, err := t.revocation.IsRevoked(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+func (a *app) startRevocationPurge() {
+	if a.tools.revocation == nil || a.revocationPurgeInterval < 0 {
+		return
+	}
+	interval := a.revocationPurgeInterval
+	if interval == 0 {
+		interval = DefaultRevocationPurgeInterval
+	}
+	var ctx context.Context
+	ctx, a.revocationCancel = context.WithCancel(context.Background())
+	a.revocationDone = make(chan struct{})
+	go func() {
+		defer close(a.revocationDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := a.tools.revocation.Purge(ctx, time.Now())
+				if err != nil {
+					a.tools.log.Warn("failed to purge revoked tokens",
+						zap.Error(err))
+					continue
+				}
+				a.tools.log.Debug("purged revoked tokens",
+					zap.Int64("purged", n))
+			}
+		}
+	}()
+}
+
+// stopRevocationPurge and wait for running purge to return.
+func (a *app) stopRevocationPurge() {
+	if a.revocationCancel == nil {
+		return
+	}
+	a.revocationCancel()
+	<-a.revocationDone
+}
+
+// MemoryRevocationStore keeps revoked tokens in memory of the process.
+func MemoryRevocationStore() RevocationStore {
+	return &memoryRevocationStore{revoked: make(map[string]time.Time)}
+}
+
+type memoryRevocationStore struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+func (s *memoryRevocationStore) Revoke(_ context.Context, key string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// keep the latest expiration, zero is the latest
+	current, ok := s.revoked[key]
+	if !ok || expiresAt.IsZero() || !current.IsZero() && expiresAt.After(current) {
+		s.revoked[key] = expiresAt
+	}
+	return nil
+}
+
+func (s *memoryRevocationStore) IsRevoked(_ context.Context, key string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	expiresAt, ok := s.revoked[key]
+	return ok && (expiresAt.IsZero() || expiresAt.After(time.Now())), nil
+}
+
+func (s *memoryRevocationStore) Purge(_ context.Context, t time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for key, expiresAt := range s.revoked {
+		if !expiresAt.IsZero() && expiresAt.Before(t) {
+			delete(s.revoked, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// PostgresRevocationStore keeps revoked tokens in table of application database (see
+// WithDatabasePool):
+//
+//	CREATE TABLE revoked_tokens (
+//		key        text PRIMARY KEY,
+//		expires_at timestamptz
+//	);
+//
+// Table name may be qualified with schema, e.g. "auth.revoked_tokens".
+func PostgresRevocationStore(table string) RevocationStore {
+	return &postgresRevocationStore{table: pgx.Identifier(strings.Split(table, ".")).Sanitize()}
+}
+
+type postgresRevocationStore struct {
+	table string
+	tools Tools
+}
+
+func (s *postgresRevocationStore) UseTools(t Tools) {
+	s.tools = t
+}
+
+func (s *postgresRevocationStore) exec(ctx context.Context, sql string, args ...any) (int64, error) {
+	if s.tools == nil || s.tools.DBPool() == nil {
+		return 0, errors.New("revocation database is not initialized")
+	}
+	tag, err := s.tools.DBPool().Exec(ctx, sql, args...)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (s *postgresRevocationStore) Revoke(ctx context.Context, key string, expiresAt time.Time) error {
+	var exp *time.Time
+	if !expiresAt.IsZero() {
+		exp = &expiresAt
+	}
+	_, err := s.exec(ctx,
+		"INSERT INTO "+s.table+" AS revoked (key, expires_at) VALUES ($1, $2) "+
+			"ON CONFLICT (key) DO UPDATE SET expires_at = CASE "+
+			"WHEN revoked.expires_at IS NULL OR EXCLUDED.expires_at IS NULL THEN NULL "+
+			"ELSE GREATEST(revoked.expires_at, EXCLUDED.expires_at) END",
+		key, exp)
+	return err
+}
+
+func (s *postgresRevocationStore) IsRevoked(ctx context.Context, key string) (bool, error) {
+	if s.tools == nil || s.tools.DBPool() == nil {
+		return false, errors.New("revocation database is not initialized")
+	}
+	var revoked bool
+	err := s.tools.DBPool().QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM "+s.table+" WHERE key = $1 AND (expires_at IS NULL OR expires_at > now()))",
+		key,
+	).Scan(&revoked)
+	return revoked, err
+}
+
+func (s *postgresRevocationStore) Purge(ctx context.Context, t time.Time) (int64, error) {
+	return s.exec(ctx, "DELETE FROM "+s.table+" WHERE expires_at < $1", t)
+}
@@ -0,0 +1,283 @@
+package grpcapp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestTokenRevocationKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		want    string
+		wantErr bool
+	}{
+		{"jti", jwt.MapClaims{"jti": "id", "sub": "alice", "iat": float64(1)}, "jti:id", false},
+		{"sub and iat", jwt.MapClaims{"sub": "alice", "iat": float64(1700000000)}, "sub:alice:1700000000", false},
+		{"empty jti", jwt.MapClaims{"jti": "", "sub": "alice", "iat": float64(1)}, "sub:alice:1", false},
+		{"sub only", jwt.MapClaims{"sub": "alice"}, "", true},
+		{"no claims", jwt.MapClaims{}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TokenRevocationKey(tt.claims)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TokenRevocationKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("TokenRevocationKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryRevocationStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := MemoryRevocationStore()
+	revoked := func(key string) bool {
+		ok, err := store.IsRevoked(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	_ = store.Revoke(ctx, "active", now.Add(time.Hour))
+	_ = store.Revoke(ctx, "expired", now.Add(-time.Hour))
+	_ = store.Revoke(ctx, "forever", time.Time{})
+	_ = store.Revoke(ctx, "forever", now.Add(time.Hour))
+	_ = store.Revoke(ctx, "extended", now.Add(-time.Hour))
+	_ = store.Revoke(ctx, "extended", now.Add(time.Hour))
+	_ = store.Revoke(ctx, "extended", now.Add(-time.Hour))
+	for key, want := range map[string]bool{
+		"active":   true,
+		"expired":  false,
+		"forever":  true,
+		"extended": true,
+		"unknown":  false,
+	} {
+		if got := revoked(key); got != want {
+			t.Errorf("IsRevoked(%s) = %v, want %v", key, got, want)
+		}
+	}
+	n, err := store.Purge(ctx, now)
+	if err != nil || n != 1 {
+		t.Errorf("Purge() = %v, %v, want 1", n, err)
+	}
+	if n, _ = store.Purge(ctx, now.Add(2*time.Hour)); n != 2 {
+		t.Errorf("Purge() = %v, want 2", n)
+	}
+	if !revoked("forever") {
+		t.Error("revoked forever key was purged")
+	}
+}
+
+func TestPostgresRevocationStore(t *testing.T) {
+	store := PostgresRevocationStore("auth.revoked_tokens").(*postgresRevocationStore)
+	if store.table != `"auth"."revoked_tokens"` {
+		t.Errorf("table = %v", store.table)
+	}
+	ctx := context.Background()
+	if err := store.Revoke(ctx, "key", time.Now()); err == nil {
+		t.Error("Revoke() without database expected error")
+	}
+	if _, err := store.IsRevoked(ctx, "key"); err == nil {
+		t.Error("IsRevoked() without database expected error")
+	}
+	if _, err := store.Purge(ctx, time.Now()); err == nil {
+		t.Error("Purge() without database expected error")
+	}
+}
+
+func Test_postgresRevocationStore(t *testing.T) {
+	pool, schema := testDatabaseSchema(t)
+	ctx := context.Background()
+	_, err := pool.Exec(ctx, "CREATE TABLE "+schema+".revoked_tokens (key text PRIMARY KEY, expires_at timestamptz)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := PostgresRevocationStore(schema + ".revoked_tokens")
+	useTools(store, &tools{pool: pool})
+
+	now := time.Now()
+	revoke := func(key string, expiresAt time.Time) {
+		if err := store.Revoke(ctx, key, expiresAt); err != nil {
+			t.Fatalf("Revoke(%s) error = %v", key, err)
+		}
+	}
+	revoked := func(key string) bool {
+		ok, err := store.IsRevoked(ctx, key)
+		if err != nil {
+			t.Fatalf("IsRevoked(%s) error = %v", key, err)
+		}
+		return ok
+	}
+	expiresAt := func(key string) *time.Time {
+		var exp *time.Time
+		if err := pool.QueryRow(ctx, "SELECT expires_at FROM "+schema+".revoked_tokens WHERE key = $1", key).Scan(&exp); err != nil {
+			t.Fatalf("expires_at of %s error = %v", key, err)
+		}
+		return exp
+	}
+
+	revoke("later", now.Add(time.Hour))
+	revoke("later", now.Add(time.Minute))
+	if exp := expiresAt("later"); exp == nil || exp.Before(now.Add(time.Hour-time.Second)) {
+		t.Errorf("expected the later expiration kept, got %v", exp)
+	}
+	revoke("forever", now.Add(time.Hour))
+	revoke("forever", time.Time{})
+	revoke("forever", now.Add(time.Minute))
+	if exp := expiresAt("forever"); exp != nil {
+		t.Errorf("expected no expiration, got %v", exp)
+	}
+	revoke("expired", now.Add(-time.Minute))
+
+	if !revoked("later") || !revoked("forever") {
+		t.Error("expected keys revoked")
+	}
+	if revoked("expired") || revoked("unknown") {
+		t.Error("unexpected expired or unknown key revoked")
+	}
+	n, err := store.Purge(ctx, now)
+	if err != nil || n != 1 {
+		t.Errorf("Purge() = %v, %v, want 1", n, err)
+	}
+	if !revoked("later") || !revoked("forever") {
+		t.Error("revoked keys were purged")
+	}
+}
+
+func Test_tools_RevokeToken(t *testing.T) {
+	ctx := context.Background()
+	token := &jwt.Token{Claims: jwt.MapClaims{"jti": "id", "exp": float64(time.Now().Add(time.Hour).Unix())}}
+	if err := (&tools{log: zap.NewNop()}).RevokeToken(ctx, token); err == nil {
+		t.Error("RevokeToken() without revocation expected error")
+	}
+	tl := &tools{log: zap.NewNop(), revocation: MemoryRevocationStore()}
+	if err := tl.checkRevoked(ctx, token); err != nil {
+		t.Fatalf("checkRevoked() = %v", err)
+	}
+	if err := tl.RevokeToken(ctx, &jwt.Token{Claims: jwt.MapClaims{}}); !errors.Is(err, ErrNoRevocationKey) {
+		t.Errorf("RevokeToken() without key error = %v", err)
+	}
+	if err := tl.RevokeToken(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if err := tl.checkRevoked(ctx, token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("checkRevoked() = %v, want %v", err, ErrTokenRevoked)
+	}
+	if err := tl.checkRevoked(ctx, &jwt.Token{Claims: jwt.MapClaims{}}); err != nil {
+		t.Errorf("checkRevoked() of token without key = %v", err)
+	}
+}
+
+func Test_app_tokenRevocation(t *testing.T) {
+	secret := []byte("secret")
+	keyFunc := func(*jwt.Token) (any, error) {
+		return secret, nil
+	}
+	sign := func(claims jwt.MapClaims) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	iat := float64(time.Now().Unix())
+	leaked := sign(jwt.MapClaims{"jti": "leaked"})
+	other := sign(jwt.MapClaims{"jti": "other"})
+	loggedOut := sign(jwt.MapClaims{"sub": "alice", "iat": iat})
+
+	tests := []struct {
+		name    string
+		options []Option
+	}{
+		{"jwt authentication", []Option{WithJwtAuthentication(keyFunc)}},
+		{"jwt authenticator", []Option{WithAuthenticator(JwtAuthenticator(keyFunc))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := MemoryRevocationStore()
+			a := New(append(tt.options,
+				WithConfig(&Config{LogLevel: "info"}),
+				WithTokenRevocation(store, 10*time.Millisecond),
+				WithServiceImplementation(whoamiServiceDesc(), new(whoamiImplementation)),
+			)...)
+			go func() {
+				_ = a.Run(context.Background())
+			}()
+			<-a.Ready()
+			defer func() {
+				_ = a.Stop(context.Background())
+			}()
+			conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+			call := func(token string) codes.Code {
+				ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", token)
+				err := conn.Invoke(ctx, "/grpcapp.test.Whoami/Public", new(emptypb.Empty), new(wrapperspb.StringValue))
+				return status.Code(err)
+			}
+			for _, token := range []string{leaked, other, loggedOut} {
+				if got := call(token); got != codes.OK {
+					t.Fatalf("code before revocation = %v", got)
+				}
+			}
+
+			ctx := context.Background()
+			if err = store.Revoke(ctx, "jti:leaked", time.Time{}); err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := jwt.Parse(loggedOut, keyFunc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = a.Tools().RevokeToken(ctx, parsed); err != nil {
+				t.Fatal(err)
+			}
+			for token, want := range map[string]codes.Code{
+				leaked:    codes.Unauthenticated,
+				other:     codes.OK,
+				loggedOut: codes.Unauthenticated,
+			} {
+				if got := call(token); got != want {
+					t.Errorf("code after revocation = %v, want %v", got, want)
+				}
+			}
+
+			// expired entries are purged
+			_ = store.Revoke(ctx, "jti:expired", time.Now().Add(-time.Second))
+			deadline := time.Now().Add(time.Second)
+			for {
+				s := store.(*memoryRevocationStore)
+				s.mu.RLock()
+				_, ok := s.revoked["jti:expired"]
+				s.mu.RUnlock()
+				if !ok {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("expired entry was not purged")
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	}
+}
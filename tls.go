@@ -0,0 +1,192 @@
+package grpcapp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func (a *app) initTLS() error {
+	cfg := a.tools.cfg
+	if cfg.TLSCertificate == "" && cfg.TLSKey == "" {
+		if cfg.TLSClientCA != "" {
+			return newError(PhaseTLS, "cannot verify client certificates", errors.New("tls certificate is missing"))
+		}
+		return nil
+	}
+	if cfg.TLSCertificate == "" {
+		return newError(PhaseTLS, "cannot configure tls", errors.New("tls certificate is missing"))
+	}
+	if cfg.TLSKey == "" {
+		return newError(PhaseTLS, "cannot configure tls", errors.New("tls key is missing"))
+	}
+	r := &certReloader{
+		certFile: cfg.TLSCertificate,
+		keyFile:  cfg.TLSKey,
+		caFile:   cfg.TLSClientCA,
+		interval: cfg.TLSReloadInterval,
+		log:      a.tools.log,
+	}
+	if err := r.load(); err != nil {
+		return newError(PhaseTLS, "failed to load tls files", err)
+	}
+	a.tls = r
+	a.tools.log.Info("configured tls",
+		zap.String("tlsCertificate", cfg.TLSCertificate),
+		zap.String("tlsKey", cfg.TLSKey),
+		zap.String("tlsClientCA", cfg.TLSClientCA),
+		zap.Duration("reloadInterval", cfg.TLSReloadInterval))
+	return nil
+}
+
+// serverCredentials are TLS credentials skipping the handshake on in-process
+// gateway connections, which are not exposed to the network.
+type serverCredentials struct {
+	credentials.TransportCredentials
+}
+
+func (c serverCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if _, ok := conn.(gatewayConn); ok {
+		return insecure.NewCredentials().ServerHandshake(conn)
+	}
+	return c.TransportCredentials.ServerHandshake(conn)
+}
+
+func (c serverCredentials) Clone() credentials.TransportCredentials {
+	return serverCredentials{c.TransportCredentials.Clone()}
+}
+
+// requireClientCertificate rejects native gRPC requests to the HTTP server
+// made without a verified client certificate if client CA bundle is set, so
+// the HTTP listener does not bypass mutual TLS of the gRPC listener.
+func (a *app) requireClientCertificate(h http.Handler) http.Handler {
+	if a.tls == nil || a.tls.caFile == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGrpcRequest(r) && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Grpc-Status", strconv.Itoa(int(codes.Unauthenticated)))
+			w.Header().Set("Grpc-Message", "client certificate required")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// certReloader keeps TLS key pair and client CA bundle loaded from files,
+// reloading them when changed on disk (e.g. rotated by cert-manager).
+type certReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	interval time.Duration
+	log      *zap.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+	checked time.Time
+}
+
+// config returns server TLS config using the current files, client
+// certificates are verified with clientAuth if client CA bundle is set.
+func (r *certReloader) config(clientAuth tls.ClientAuthType, nextProtos ...string) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     nextProtos,
+		GetCertificate: r.getCertificate,
+	}
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, pool := r.current()
+		c := cfg.Clone()
+		c.Certificates = []tls.Certificate{*cert}
+		if pool != nil {
+			c.ClientCAs = pool
+			c.ClientAuth = clientAuth
+		}
+		return c, nil
+	}
+	return cfg
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, _ := r.current()
+	return cert, nil
+}
+
+// current returns the key pair and client CA pool, reloading them if
+// files were modified since the last check.
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.interval > 0 && time.Since(r.checked) >= r.interval {
+		r.checked = time.Now()
+		if modTime, err := r.lastModified(); err == nil && modTime.After(r.modTime) {
+			if err = r.load(); err != nil {
+				r.log.Error("failed to reload tls files",
+					zap.Error(err))
+			} else {
+				r.log.Info("reloaded tls files",
+					zap.Time("modTime", r.modTime))
+			}
+		}
+	}
+	return r.cert, r.pool
+}
+
+// load reads the files, keeping previous ones on failure.
+func (r *certReloader) load() error {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in " + r.caFile)
+		}
+	}
+	r.cert, r.pool, r.modTime = &cert, pool, modTime
+	return nil
+}
+
+// lastModified returns the latest modification time of the files.
+func (r *certReloader) lastModified() (time.Time, error) {
+	var last time.Time
+	for _, name := range []string{r.certFile, r.keyFile, r.caFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last, nil
+}
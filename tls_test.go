@@ -0,0 +1,344 @@
+package grpcapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// testCA issues certificates for tls tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns PEM encoded certificate and key, cn is used as DNS SAN as well.
+func (ca *testCA) issue(t *testing.T, cn string, uris ...string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, u := range uris {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.URIs = append(tmpl.URIs, parsed)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// keyPair returns tls.Certificate issued by ca.
+func (ca *testCA) keyPair(t *testing.T, cn string, uris ...string) tls.Certificate {
+	certPEM, keyPEM := ca.issue(t, cn, uris...)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func writeTestFile(t *testing.T, name string, data []byte) {
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_app_initTLS(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	badFile := filepath.Join(t.TempDir(), "bad.pem")
+	writeTestFile(t, badFile, []byte("bad"))
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantTLS bool
+		wantErr bool
+	}{
+		{"without tls", &Config{}, false, false},
+		{"with tls", &Config{TLSCertificate: certFile, TLSKey: keyFile}, true, false},
+		{"with client ca", &Config{TLSCertificate: certFile, TLSKey: keyFile, TLSClientCA: certFile}, true, false},
+		{"client ca only", &Config{TLSClientCA: certFile}, false, true},
+		{"key missing", &Config{TLSCertificate: certFile}, false, true},
+		{"certificate missing", &Config{TLSKey: keyFile}, false, true},
+		{"bad key pair", &Config{TLSCertificate: badFile, TLSKey: keyFile}, false, true},
+		{"bad client ca", &Config{TLSCertificate: certFile, TLSKey: keyFile, TLSClientCA: badFile}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &app{tools: &tools{cfg: tt.cfg, log: zap.NewNop()}}
+			err := a.initTLS()
+			var appErr *Error
+			if tt.wantErr != (err != nil) || (err != nil && (!errors.As(err, &appErr) || appErr.Phase != PhaseTLS)) {
+				t.Errorf("initTLS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (a.tls != nil) != tt.wantTLS {
+				t.Errorf("expected tls configured %v", tt.wantTLS)
+			}
+		})
+	}
+}
+
+func Test_certReloader_current(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	certPEM, keyPEM := ca.issue(t, "first")
+	writeTestFile(t, certFile, certPEM)
+	writeTestFile(t, keyFile, keyPEM)
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: time.Nanosecond, log: zap.NewNop()}
+	if err := r.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// rotate writes files in the future so modification time is changed
+	rotate := func(certPEM, keyPEM []byte) {
+		writeTestFile(t, certFile, certPEM)
+		writeTestFile(t, keyFile, keyPEM)
+		next := r.modTime.Add(time.Second)
+		for _, name := range []string{certFile, keyFile} {
+			if err := os.Chtimes(name, next, next); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	commonName := func() string {
+		cert, _ := r.current()
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.Subject.CommonName
+	}
+
+	if got := commonName(); got != "first" {
+		t.Errorf("expected first certificate, got %s", got)
+	}
+	rotate(ca.issue(t, "second"))
+	if got := commonName(); got != "second" {
+		t.Errorf("expected reloaded certificate, got %s", got)
+	}
+	rotate([]byte("bad"), []byte("bad"))
+	if got := commonName(); got != "second" {
+		t.Errorf("expected previous certificate kept, got %s", got)
+	}
+}
+
+func Test_app_grpcTLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	certPEM, keyPEM := ca.issue(t, "localhost")
+	writeTestFile(t, certFile, certPEM)
+	writeTestFile(t, keyFile, keyPEM)
+	writeTestFile(t, caFile, ca.pem)
+
+	a := New(WithConfig(&Config{
+		LogLevel:       "info",
+		TLSCertificate: certFile,
+		TLSKey:         keyFile,
+		TLSClientCA:    caFile,
+	}))
+	go func() {
+		_ = a.Run(context.Background())
+	}()
+	<-a.Ready()
+	defer func() {
+		_ = a.Stop(context.Background())
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	other := newTestCA(t)
+	tests := []struct {
+		name    string
+		creds   credentials.TransportCredentials
+		wantErr bool
+	}{
+		{"plaintext", insecure.NewCredentials(), true},
+		{"without client certificate", credentials.NewTLS(&tls.Config{RootCAs: roots, ServerName: "localhost"}), true},
+		{"untrusted client certificate", credentials.NewTLS(&tls.Config{
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: []tls.Certificate{other.keyPair(t, "client")},
+		}), true},
+		{"client certificate", credentials.NewTLS(&tls.Config{
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: []tls.Certificate{ca.keyPair(t, "client")},
+		}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(tt.creds))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_app_httpTLSClientCA(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	certPEM, keyPEM := ca.issue(t, "localhost")
+	writeTestFile(t, certFile, certPEM)
+	writeTestFile(t, keyFile, keyPEM)
+	writeTestFile(t, caFile, ca.pem)
+
+	for _, singlePort := range []bool{false, true} {
+		t.Run(fmt.Sprintf("singlePort=%t", singlePort), func(t *testing.T) {
+			a := New(
+				WithConfig(&Config{
+					LogLevel:       "info",
+					TLSCertificate: certFile,
+					TLSKey:         keyFile,
+					TLSClientCA:    caFile,
+					SinglePort:     singlePort,
+				}),
+				WithHTTP(),
+				WithGrpcWeb(),
+			)
+			go func() {
+				_ = a.Run(context.Background())
+			}()
+			<-a.Ready()
+			defer func() {
+				_ = a.Stop(context.Background())
+			}()
+
+			// plain http requests do not require client certificates
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.cert)
+			tlsConfig := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, ForceAttemptHTTP2: true}}
+			res, err := client.Get("https://" + a.HttpAddr().String() + "/")
+			if err != nil {
+				t.Fatalf("http request without client certificate failed: %v", err)
+			}
+			_ = res.Body.Close()
+
+			// neither do grpc-web requests
+			req, _ := http.NewRequest(http.MethodPost, "https://"+a.HttpAddr().String()+"/grpc.health.v1.Health/Check",
+				bytes.NewReader(grpcWebFrame(t, &healthpb.HealthCheckRequest{})))
+			req.Header.Set("Content-Type", "application/grpc-web+proto")
+			req.Header.Set("X-Grpc-Web", "1")
+			res, err = client.Do(req)
+			if err != nil {
+				t.Fatalf("grpc-web request without client certificate failed: %v", err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			_ = res.Body.Close()
+			if res.ProtoMajor != 2 || !bytes.Contains(body, []byte("grpc-status: 0")) {
+				t.Errorf("unexpected grpc-web response over HTTP/%d: %q", res.ProtoMajor, body)
+			}
+
+			// native grpc requests do
+			tests := []struct {
+				name     string
+				addr     string
+				config   *tls.Config
+				wantCode codes.Code
+			}{
+				{"http without client certificate", a.HttpAddr().String(), tlsConfig, codes.Unauthenticated},
+				{"http with client certificate", a.HttpAddr().String(), &tls.Config{
+					RootCAs:      roots,
+					ServerName:   "localhost",
+					Certificates: []tls.Certificate{ca.keyPair(t, "client")},
+				}, codes.OK},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					conn, err := grpc.Dial(tt.addr, grpc.WithTransportCredentials(credentials.NewTLS(tt.config)))
+					if err != nil {
+						t.Fatal(err)
+					}
+					defer func() {
+						_ = conn.Close()
+					}()
+					ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+					defer cancel()
+					_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+					if code := status.Code(err); code != tt.wantCode {
+						t.Errorf("Check() error = %v, want code %s", err, tt.wantCode)
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package grpcapp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	grpcCtxTags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelCodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// Tracing exporters supported by Config.TracingExporter.
+const (
+	// TracingExporterOTLP exports spans using OTLP over gRPC, configured with standard
+	// OTEL_EXPORTER_OTLP_* environment variables.
+	TracingExporterOTLP = "otlp"
+
+	// TracingExporterStdout writes spans to stdout, useful for local debugging.
+	TracingExporterStdout = "stdout"
+)
+
+const (
+	// TraceIDTag is the log field holding trace id of the request.
+	TraceIDTag = "trace_id"
+
+	// SpanIDTag is the log field holding span id of the request.
+	SpanIDTag = "span_id"
+)
+
+// WithTracing option enables OpenTelemetry tracing. Incoming W3C traceparent headers
+// are propagated from metadata and trace_id/span_id are added to request logs.
+// Queries of the database pool created from DatabaseDSN create child spans, pools
+// passed with WithDatabasePool and connections passed with WithDatabase are not
+// traced. The exporter is configured with Config.TracingExporter. Server
+// interceptors are not installed if WithGrpcServer option is used.
+func WithTracing() Option {
+	return new(tracingOption)
+}
+
+type tracingOption struct{}
+
+func (*tracingOption) option(a *app) {
+	a.tracing = true
+}
+
+func (a *app) initTracing() error {
+	if !a.tracing || a.tracerProvider != nil {
+		return nil
+	}
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch a.tools.cfg.TracingExporter {
+	case "", TracingExporterOTLP:
+		exporter, err = otlptracegrpc.New(context.Background())
+	case TracingExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		err = errors.New("unknown exporter " + a.tools.cfg.TracingExporter)
+	}
+	if err != nil {
+		return newError(PhaseTracing, "failed to create tracing exporter", err)
+	}
+	res := resource.Default()
+	if a.tools.cfg.TracingServiceName != "" {
+		res, err = resource.Merge(res, resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(a.tools.cfg.TracingServiceName),
+		))
+		if err != nil {
+			return newError(PhaseTracing, "failed to create tracing resource", err)
+		}
+	}
+	a.tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	a.propagator = propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	)
+	otel.SetTracerProvider(a.tracerProvider)
+	otel.SetTextMapPropagator(a.propagator)
+	return nil
+}
+
+func (a *app) shutdownTracing(ctx context.Context) {
+	if a.tracerProvider != nil {
+		if err := a.tracerProvider.Shutdown(ctx); err != nil {
+			a.tools.log.Error("failed to shutdown tracer provider",
+				zap.Error(err))
+		}
+		a.tracerProvider = nil
+	}
+}
+
+func (a *app) makeTracingInterceptors() (
+	grpc.UnaryServerInterceptor,
+	grpc.StreamServerInterceptor,
+) {
+	opts := []otelgrpc.Option{
+		otelgrpc.WithTracerProvider(a.tracerProvider),
+		otelgrpc.WithPropagators(a.propagator),
+	}
+	return otelgrpc.UnaryServerInterceptor(opts...), otelgrpc.StreamServerInterceptor(opts...)
+}
+
+// traceTags adds trace_id and span_id of the current span to request tags, which are
+// included by the logging interceptor. Must be used after grpcCtxTags interceptors.
+func traceTags(ctx context.Context) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	grpcCtxTags.Extract(ctx).
+		Set(TraceIDTag, sc.TraceID().String()).
+		Set(SpanIDTag, sc.SpanID().String())
+}
+
+func traceTagsUnaryInterceptor(
+	ctx context.Context,
+	req any,
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	traceTags(ctx)
+	return handler(ctx, req)
+}
+
+func traceTagsStreamInterceptor(
+	srv any,
+	stream grpc.ServerStream,
+	_ *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	traceTags(stream.Context())
+	return handler(srv, stream)
+}
+
+// dbTracer implements pgx.Logger, creating a span for every completed database
+// operation which has a parent span in its context. Messages are passed to the
+// next logger, if any, up to its level.
+type dbTracer struct {
+	tracer    trace.Tracer
+	next      pgx.Logger
+	nextLevel pgx.LogLevel
+}
+
+func newDBTracer(tp trace.TracerProvider, next pgx.Logger, nextLevel pgx.LogLevel) *dbTracer {
+	return &dbTracer{tp.Tracer("github.com/skamenetskiy/grpcapp/db"), next, nextLevel}
+}
+
+// Log implements pgx.Logger.
+func (t *dbTracer) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]any) {
+	if t.next != nil && t.nextLevel >= level {
+		t.next.Log(ctx, level, msg, data)
+	}
+	d, ok := data["time"].(time.Duration)
+	if !ok || !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+	end := time.Now()
+	attrs := []attribute.KeyValue{semconv.DBSystemPostgreSQL}
+	if sql, ok := data["sql"].(string); ok {
+		attrs = append(attrs, semconv.DBStatement(sql))
+	}
+	_, span := t.tracer.Start(ctx, "db."+msg,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(end.Add(-d)),
+		trace.WithAttributes(attrs...))
+	if err, ok := data["err"].(error); ok {
+		span.RecordError(err)
+		span.SetStatus(otelCodes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
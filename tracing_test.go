@@ -0,0 +1,193 @@
+package grpcapp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestWithTracing(t *testing.T) {
+	a := &app{}
+	WithTracing().option(a)
+	if !a.tracing {
+		t.Error("expected tracing to be enabled")
+	}
+}
+
+func Test_app_initTracing(t *testing.T) {
+	tests := []struct {
+		name     string
+		tracing  bool
+		exporter string
+		wantErr  bool
+		wantTP   bool
+	}{
+		{"disabled", false, "", false, false},
+		{"stdout", true, TracingExporterStdout, false, true},
+		{"unknown", true, "unknown", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &app{
+				tools:   &tools{cfg: &Config{TracingExporter: tt.exporter}, log: zap.NewNop()},
+				tracing: tt.tracing,
+			}
+			err := a.initTracing()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("initTracing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (a.tracerProvider != nil) != tt.wantTP {
+				t.Errorf("expected tracer provider %v, got %v", tt.wantTP, a.tracerProvider)
+			}
+			a.shutdownTracing(context.Background())
+		})
+	}
+}
+
+func Test_app_tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	core, logs := observer.New(zap.DebugLevel)
+	a := New(
+		WithConfig(&Config{}),
+		WithLogger(zap.New(core)),
+		WithTracing(),
+	).(*app)
+	a.tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	a.propagator = propagation.TraceContext{}
+	go func() {
+		_ = a.Run(context.Background())
+	}()
+	<-a.Ready()
+	defer func() {
+		_ = a.Stop(context.Background())
+	}()
+
+	conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		"traceparent", "00-"+traceID+"-"+spanID+"-01")
+	if _, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if got := span.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("expected trace id %s, got %s", traceID, got)
+	}
+	if got := span.Parent().SpanID().String(); got != spanID {
+		t.Errorf("expected parent span id %s, got %s", spanID, got)
+	}
+
+	entries := logs.FilterMessageSnippet("finished unary call").All()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 log entry, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields[TraceIDTag] != traceID {
+		t.Errorf("expected log field %s = %s, got %v", TraceIDTag, traceID, fields[TraceIDTag])
+	}
+	if fields[SpanIDTag] != span.SpanContext().SpanID().String() {
+		t.Errorf("expected log field %s = %s, got %v", SpanIDTag, span.SpanContext().SpanID(), fields[SpanIDTag])
+	}
+}
+
+func Test_dbTracer_Log(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	parentCtx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	defer parent.End()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		msg        string
+		data       map[string]any
+		wantSpan   bool
+		wantStatus codes.Code
+	}{
+		{"without parent", context.Background(), "Query", map[string]any{"time": time.Millisecond}, false, codes.Unset},
+		{"without time", parentCtx, "Dialing PostgreSQL server", map[string]any{}, false, codes.Unset},
+		{"query", parentCtx, "Query", map[string]any{"sql": "select 1", "time": time.Millisecond}, true, codes.Unset},
+		{"error", parentCtx, "Exec", map[string]any{"err": errors.New("err"), "time": time.Millisecond}, true, codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(recorder.Ended())
+			newDBTracer(tp, nil, pgx.LogLevelNone).Log(tt.ctx, pgx.LogLevelInfo, tt.msg, tt.data)
+			spans := recorder.Ended()[before:]
+			if (len(spans) == 1) != tt.wantSpan {
+				t.Fatalf("expected span %v, got %d spans", tt.wantSpan, len(spans))
+			}
+			if !tt.wantSpan {
+				return
+			}
+			span := spans[0]
+			if span.Name() != "db."+tt.msg {
+				t.Errorf("expected span name %s, got %s", "db."+tt.msg, span.Name())
+			}
+			if span.Parent().SpanID() != trace.SpanContextFromContext(parentCtx).SpanID() {
+				t.Errorf("expected span to be a child of parent span")
+			}
+			if span.Status().Code != tt.wantStatus {
+				t.Errorf("expected status %v, got %v", tt.wantStatus, span.Status().Code)
+			}
+		})
+	}
+}
+
+func Test_dbTracer_next(t *testing.T) {
+	var levels []pgx.LogLevel
+	next := pgx.LoggerFunc(func(_ context.Context, level pgx.LogLevel, _ string, _ map[string]any) {
+		levels = append(levels, level)
+	})
+	tracer := newDBTracer(sdktrace.NewTracerProvider(), next, pgx.LogLevelWarn)
+	for _, level := range []pgx.LogLevel{pgx.LogLevelError, pgx.LogLevelWarn, pgx.LogLevelInfo} {
+		tracer.Log(context.Background(), level, "Query", map[string]any{})
+	}
+	if want := []pgx.LogLevel{pgx.LogLevelError, pgx.LogLevelWarn}; !reflect.DeepEqual(levels, want) {
+		t.Errorf("next logger levels = %v, want %v", levels, want)
+	}
+}
+
+func Test_app_tracingStartFailure(t *testing.T) {
+	a := New(
+		WithConfig(&Config{LogLevel: "info"}),
+		WithTracing(),
+		WithStartHook(func(App) error { return errors.New("failed") }),
+	).(*app)
+	a.tracerProvider = sdktrace.NewTracerProvider()
+	if err := a.Run(context.Background()); err == nil {
+		t.Fatal("Run() expected error")
+	}
+	if a.tracerProvider != nil {
+		t.Error("expected tracer provider to be shut down")
+	}
+}
@@ -0,0 +1,159 @@
+package grpcapp
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bufbuild/protovalidate-go"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// WithValidation enables validation of incoming messages before handlers are called,
+// with generated ValidateAll() or Validate() methods (protoc-gen-validate) and
+// buf.validate field constraints (protovalidate). Invalid messages are rejected
+// with codes.InvalidArgument and google.rpc.BadRequest field violations in the
+// status details. Messages of client streams are validated when received. This
+// option is ignored if WithGrpcServer option is used.
+func WithValidation() Option {
+	return &validationOption{}
+}
+
+type validationOption struct{}
+
+func (opt *validationOption) option(a *app) {
+	a.validation = true
+}
+
+// initValidation creates protovalidate validator if validation is enabled.
+func (a *app) initValidation() error {
+	if !a.validation || a.validator != nil {
+		return nil
+	}
+	v, err := protovalidate.New()
+	if err != nil {
+		return newError(PhaseConfig, "failed to create validator", err)
+	}
+	a.validator = v
+	return nil
+}
+
+// validate msg, returns status error with InvalidArgument code if msg is invalid.
+func (a *app) validate(method string, msg any) error {
+	var violations []*errdetails.BadRequest_FieldViolation
+	switch v := msg.(type) {
+	case interface{ ValidateAll() error }:
+		violations = pgvViolations("", v.ValidateAll())
+	case interface{ Validate() error }:
+		violations = pgvViolations("", v.Validate())
+	}
+	if m, ok := msg.(proto.Message); ok && a.validator != nil {
+		err := a.validator.Validate(m)
+		var validationErr *protovalidate.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			for _, v := range validationErr.Violations {
+				violations = append(violations, &errdetails.BadRequest_FieldViolation{
+					Field:       v.FieldPath,
+					Description: v.Message,
+				})
+			}
+		case err != nil:
+			a.tools.log.Error("failed to validate message",
+				zap.String("method", method),
+				zap.Error(err))
+			return status.Error(codes.Internal, "internal error")
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	st, err := status.New(codes.InvalidArgument, "invalid request").
+		WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid request")
+	}
+	return st.Err()
+}
+
+// pgvViolations of protoc-gen-validate error, field paths of embedded message
+// errors are joined with dots.
+func pgvViolations(prefix string, err error) []*errdetails.BadRequest_FieldViolation {
+	if err == nil {
+		return nil
+	}
+	if multi, ok := err.(interface{ AllErrors() []error }); ok {
+		var violations []*errdetails.BadRequest_FieldViolation
+		for _, e := range multi.AllErrors() {
+			violations = append(violations, pgvViolations(prefix, e)...)
+		}
+		return violations
+	}
+	fieldErr, ok := err.(interface {
+		Field() string
+		Reason() string
+	})
+	if !ok {
+		return []*errdetails.BadRequest_FieldViolation{{Field: prefix, Description: err.Error()}}
+	}
+	field := fieldErr.Field()
+	if prefix != "" {
+		field = prefix + "." + field
+	}
+	if c, ok := err.(interface{ Cause() error }); ok && c.Cause() != nil {
+		if _, ok := c.Cause().(interface{ Field() string }); ok {
+			return pgvViolations(field, c.Cause())
+		}
+		if _, ok := c.Cause().(interface{ AllErrors() []error }); ok {
+			return pgvViolations(field, c.Cause())
+		}
+	}
+	return []*errdetails.BadRequest_FieldViolation{{Field: field, Description: fieldErr.Reason()}}
+}
+
+func (a *app) makeValidationInterceptors() (
+	grpc.UnaryServerInterceptor,
+	grpc.StreamServerInterceptor,
+) {
+	unaryInterceptor := func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		if err := a.validate(info.FullMethod, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+
+	streamInterceptor := func(
+		srv any,
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		return handler(srv, &validatingStream{stream, func(m any) error {
+			return a.validate(info.FullMethod, m)
+		}})
+	}
+
+	return unaryInterceptor, streamInterceptor
+}
+
+// validatingStream validates received messages.
+type validatingStream struct {
+	grpc.ServerStream
+	validate func(any) error
+}
+
+func (s *validatingStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.validate(m)
+}
@@ -0,0 +1,296 @@
+package grpcapp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// pgvFieldError mimics field error generated by protoc-gen-validate.
+type pgvFieldError struct {
+	field  string
+	reason string
+	cause  error
+}
+
+func (e pgvFieldError) Field() string  { return e.field }
+func (e pgvFieldError) Reason() string { return e.reason }
+func (e pgvFieldError) Cause() error   { return e.cause }
+func (e pgvFieldError) Error() string  { return "invalid " + e.field + ": " + e.reason }
+
+// pgvMultiError mimics multi error generated by protoc-gen-validate.
+type pgvMultiError []error
+
+func (m pgvMultiError) AllErrors() []error { return m }
+func (m pgvMultiError) Error() string      { return "multiple errors" }
+
+// pgvRequest is StringValue with generated ValidateAll method.
+type pgvRequest struct {
+	*wrapperspb.StringValue
+}
+
+func (r *pgvRequest) ValidateAll() error {
+	if r.GetValue() == "" {
+		return pgvMultiError{pgvFieldError{field: "Value", reason: "value is required"}}
+	}
+	return nil
+}
+
+func Test_pgvViolations(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want map[string]string
+	}{
+		{"nil", nil, map[string]string{}},
+		{"plain error", errors.New("invalid"), map[string]string{"": "invalid"}},
+		{"field error", pgvFieldError{field: "Name", reason: "too short"}, map[string]string{
+			"Name": "too short",
+		}},
+		{"multi error", pgvMultiError{
+			pgvFieldError{field: "Name", reason: "too short"},
+			pgvFieldError{field: "Age", reason: "must be positive"},
+		}, map[string]string{
+			"Name": "too short",
+			"Age":  "must be positive",
+		}},
+		{"embedded message", pgvFieldError{field: "Address", reason: "embedded message failed validation",
+			cause: pgvMultiError{
+				pgvFieldError{field: "City", reason: "value is required"},
+				pgvFieldError{field: "Geo", reason: "embedded message failed validation",
+					cause: pgvFieldError{field: "Lat", reason: "out of range"}},
+			}}, map[string]string{
+			"Address.City":    "value is required",
+			"Address.Geo.Lat": "out of range",
+		}},
+		{"non field cause", pgvFieldError{field: "Name", reason: "too short", cause: errors.New("cause")},
+			map[string]string{
+				"Name": "too short",
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[string]string)
+			for _, v := range pgvViolations("", tt.err) {
+				got[v.Field] = v.Description
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pgvViolations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// constrainedDescriptor of message with buf.validate constraint of "name" field
+// being at least 3 characters long.
+func constrainedDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	opts := &descriptorpb.FieldOptions{}
+	proto.SetExtension(opts, validate.E_Field, &validate.FieldConstraints{
+		Type: &validate.FieldConstraints_String_{String_: &validate.StringRules{MinLen: proto.Uint64(3)}},
+	})
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("grpcapp/test/validating.proto"),
+		Package:    proto.String("grpcapp.test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"buf/validate/validate.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Constrained"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("name"),
+				JsonName: proto.String("name"),
+				Number:   proto.Int32(1),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Options:  opts,
+			}},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd.Messages().Get(0)
+}
+
+// validatingServiceDesc of service with unary methods accepting pgvRequest and
+// constrained message, and client stream of constrained messages.
+func validatingServiceDesc(constrained protoreflect.MessageDescriptor) *grpc.ServiceDesc {
+	handler := func(any, context.Context, any) (any, error) {
+		return new(emptypb.Empty), nil
+	}
+	return &grpc.ServiceDesc{
+		ServiceName: "grpcapp.test.Validating",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{
+			unaryMethodDesc("grpcapp.test.Validating", "Pgv", func() any {
+				return &pgvRequest{new(wrapperspb.StringValue)}
+			}, handler),
+			unaryMethodDesc("grpcapp.test.Validating", "Constrained", func() any {
+				return dynamicpb.NewMessage(constrained)
+			}, handler),
+		},
+		Streams: []grpc.StreamDesc{{
+			StreamName: "Stream",
+			Handler: func(_ any, stream grpc.ServerStream) error {
+				for {
+					err := stream.RecvMsg(dynamicpb.NewMessage(constrained))
+					if errors.Is(err, io.EOF) {
+						return stream.SendMsg(new(emptypb.Empty))
+					}
+					if err != nil {
+						return err
+					}
+				}
+			},
+			ClientStreams: true,
+		}},
+	}
+}
+
+type validatingImplementation struct{}
+
+func (validatingImplementation) UseTools(_ Tools) {}
+
+// fieldViolations of BadRequest details of err.
+func fieldViolations(err error) []string {
+	var fields []string
+	for _, d := range status.Convert(err).Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+		}
+	}
+	return fields
+}
+
+func Test_app_validation(t *testing.T) {
+	constrained := constrainedDescriptor(t)
+	newConstrained := func(name string) proto.Message {
+		m := dynamicpb.NewMessage(constrained)
+		m.Set(constrained.Fields().ByName("name"), protoreflect.ValueOfString(name))
+		return m
+	}
+
+	tests := []struct {
+		name       string
+		options    []Option
+		method     string
+		req        proto.Message
+		wantCode   codes.Code
+		wantFields []string
+	}{
+		{"pgv valid", []Option{WithValidation()}, "Pgv", wrapperspb.String("value"), codes.OK, nil},
+		{"pgv invalid", []Option{WithValidation()}, "Pgv", wrapperspb.String(""), codes.InvalidArgument, []string{"Value"}},
+		{"constraint valid", []Option{WithValidation()}, "Constrained", newConstrained("abc"), codes.OK, nil},
+		{"constraint invalid", []Option{WithValidation()}, "Constrained", newConstrained("ab"), codes.InvalidArgument, []string{"name"}},
+		{"disabled pgv", nil, "Pgv", wrapperspb.String(""), codes.OK, nil},
+		{"disabled constraint", nil, "Constrained", newConstrained("ab"), codes.OK, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(append(tt.options,
+				WithConfig(&Config{LogLevel: "info"}),
+				WithServiceImplementation(validatingServiceDesc(constrained), validatingImplementation{}),
+			)...).(*app)
+			go func() {
+				_ = a.Run(context.Background())
+			}()
+			<-a.Ready()
+			defer func() {
+				_ = a.Stop(context.Background())
+			}()
+			conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+
+			err = conn.Invoke(context.Background(), "/grpcapp.test.Validating/"+tt.method, tt.req, new(emptypb.Empty))
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %v, want %v (%v)", got, tt.wantCode, err)
+			}
+			if got := fieldViolations(err); !reflect.DeepEqual(got, tt.wantFields) {
+				t.Errorf("field violations = %v, want %v", got, tt.wantFields)
+			}
+		})
+	}
+}
+
+func Test_app_validationStream(t *testing.T) {
+	constrained := constrainedDescriptor(t)
+	desc := validatingServiceDesc(constrained)
+	a := New(
+		WithConfig(&Config{LogLevel: "info"}),
+		WithValidation(),
+		WithServiceImplementation(desc, validatingImplementation{}),
+	).(*app)
+	go func() {
+		_ = a.Run(context.Background())
+	}()
+	<-a.Ready()
+	defer func() {
+		_ = a.Stop(context.Background())
+	}()
+	conn, err := grpc.Dial(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	tests := []struct {
+		name       string
+		names      []string
+		wantCode   codes.Code
+		wantFields []string
+	}{
+		{"valid", []string{"abc", "abcd"}, codes.OK, nil},
+		{"invalid", []string{"abc", "ab"}, codes.InvalidArgument, []string{"name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := conn.NewStream(context.Background(), &desc.Streams[0], "/grpcapp.test.Validating/Stream")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.names {
+				m := dynamicpb.NewMessage(constrained)
+				m.Set(constrained.Fields().ByName("name"), protoreflect.ValueOfString(name))
+				if err = stream.SendMsg(m); err != nil && !errors.Is(err, io.EOF) {
+					t.Fatal(err)
+				}
+			}
+			if err = stream.CloseSend(); err != nil {
+				t.Fatal(err)
+			}
+			err = stream.RecvMsg(new(emptypb.Empty))
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %v, want %v (%v)", got, tt.wantCode, err)
+			}
+			if got := fieldViolations(err); !reflect.DeepEqual(got, tt.wantFields) {
+				t.Errorf("field violations = %v, want %v", got, tt.wantFields)
+			}
+		})
+	}
+}